@@ -1,51 +1,103 @@
 package damsel
 
 import (
-	"io/ioutil"
-	"log"
-	"path/filepath"
+	"bytes"
+	"fmt"
 	"strings"
 
 	"dasa.cc/damsel/parse"
 )
 
-func open(filename string, dir string) []byte {
-	b, err := ioutil.ReadFile(filepath.Join(dir, filename))
-	if err != nil {
-		log.Fatal(err)
+func js(action *parse.Action) ([]byte, error) {
+	ws := action.Whitespace()
+	var buf bytes.Buffer
+	for _, v := range action.Content {
+		buf.WriteString(ws + "%script[type=\"text/javascript\"][src=\"")
+		buf.Write(action.Args)
+		buf.Write(v)
+		buf.WriteString("\"]\n")
 	}
-	return b
+	return buf.Bytes(), nil
 }
 
-func js(action *parse.Action) string {
+func css(action *parse.Action) ([]byte, error) {
 	ws := action.Whitespace()
-	s := ""
+	var buf bytes.Buffer
 	for _, v := range action.Content {
-		s += ws + "%script[type=\"text/javascript\"][src=\"" + string(action.Args) + string(v) + "\"]\n"
+		buf.WriteString(ws + "%link[rel=stylesheet][href=\"")
+		buf.Write(action.Args)
+		buf.Write(v)
+		buf.WriteString("\"]\n")
 	}
-	return s
+	return buf.Bytes(), nil
 }
 
-func css(action *parse.Action) string {
+// raw writes its arguments and content lines as text that is not escaped.
+func raw(action *parse.Action) ([]byte, error) {
 	ws := action.Whitespace()
-	s := ""
+	var buf bytes.Buffer
+	if len(action.Args) != 0 {
+		buf.WriteString(ws + "!= ")
+		buf.Write(action.Args)
+		buf.WriteString("\n")
+	}
 	for _, v := range action.Content {
-		s += ws + "%link[rel=stylesheet][href=\"" + string(action.Args) + string(v) + "\"]\n"
+		buf.WriteString(ws + "!= ")
+		buf.Write(v)
+		buf.WriteString("\n")
 	}
-	return s
+	return buf.Bytes(), nil
 }
 
-func extends(action *parse.Action) string {
-	bytes := open(string(action.Args), TemplateDir)
-	return string(bytes)
+func (t *Template) extends(action *parse.Action) ([]byte, error) {
+	return t.expand(action)
 }
 
-func include(action *parse.Action) string {
-	ws := action.Whitespace()
-	bytes := open(string(action.Args), TemplateDir)
-	s := strings.Split(string(bytes), "\n")
-	for i, l := range s {
-		s[i] = ws + l
+func (t *Template) include(action *parse.Action) ([]byte, error) {
+	ws := []byte(action.Whitespace())
+	b, err := t.expand(action)
+	if err != nil {
+		return nil, err
+	}
+	action.IndentOrigins()
+	lines := bytes.Split(b, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = append(ws[:len(ws):len(ws)], l...)
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// expand loads the file named by the action's arguments and evaluates its actions, so
+// that files it extends or includes are resolved relative to it. Files extending or
+// including one another in a cycle are an error.
+func (t *Template) expand(action *parse.Action) ([]byte, error) {
+	name := fileName(t.loader, string(action.Args))
+	for i, s := range t.stack {
+		if s == name {
+			return nil, fmt.Errorf("cycle in files %s -> %s", strings.Join(t.stack[i:], " -> "), name)
+		}
+	}
+	t.addFile(name)
+	b, err := t.load(name)
+	if err != nil {
+		return nil, err
+	}
+	t.stack = append(t.stack, name)
+	defer func() { t.stack = t.stack[:len(t.stack)-1] }()
+	p := parse.NewActionParser(name).Funcs(t.funcs)
+	if b, err = p.Parse(b); err != nil {
+		return nil, err
+	}
+	action.SetOrigins(p.Origins())
+	return b, nil
+}
+
+// addFile adds name to the files of the template, if not already listed.
+func (t *Template) addFile(name string) {
+	for _, f := range t.files {
+		if f == name {
+			return
+		}
 	}
-	return strings.Join(s, "\n")
+	t.files = append(t.files, name)
 }
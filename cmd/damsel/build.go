@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"dasa.cc/damsel"
+)
+
+// build renders a directory of templates to html files, and with watch set, polls the
+// directory to render templates again as they or the files they include and extend change.
+func build(args []string, watch bool) error {
+	name := "build"
+	if watch {
+		name = "watch"
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	src := flags.String("src", ".", "directory of templates to render")
+	out := flags.String("out", "", "directory to write html to")
+	html := flags.Bool("html", false, "executes templates with html/template pkg; if unset, will be true if data is set")
+	data := flags.String("data", "", "json string to decode as data for templates")
+	var interval *time.Duration
+	if watch {
+		interval = flags.Duration("interval", time.Second, "how often to poll the source directory for changes")
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: damsel %s -src dir -out dir [flags]\n", name)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *out == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	b := &builder{src: *src, out: *out, html: *html || *data != "", files: make(map[string][]string)}
+	if *data != "" {
+		if err := json.Unmarshal([]byte(*data), &b.data); err != nil {
+			return err
+		}
+	}
+	if !watch {
+		names, err := b.templates()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := b.build(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return b.watch(*interval)
+}
+
+// builder renders the templates of a source directory to html files of the same path in
+// an output directory.
+type builder struct {
+	src, out string
+	html     bool
+	data     interface{}
+
+	// files each template was last parsed from, by template name
+	files map[string][]string
+}
+
+// templates returns the names of the templates to render, in lexical order.
+func (b *builder) templates() ([]string, error) {
+	var names []string
+	err := fs.WalkDir(os.DirFS(b.src), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".dmsl" {
+			return nil
+		}
+		names = append(names, name)
+		return nil
+	})
+	return names, err
+}
+
+// output returns the file the named template is rendered to.
+func (b *builder) output(name string) string {
+	return filepath.Join(b.out, filepath.FromSlash(strings.TrimSuffix(name, ".dmsl")+".html"))
+}
+
+// build renders the named template to its output, recording the files it was parsed from.
+func (b *builder) build(name string) error {
+	t := damsel.New().Loader(damsel.DirLoader(b.src))
+	err := t.ParseFile(name)
+	b.files[name] = srcNames(t.Files())
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if b.html {
+		err = t.Execute(&buf, b.data)
+	} else {
+		err = t.Render(&buf)
+	}
+	if err != nil {
+		return err
+	}
+	out := b.output(name)
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, buf.Bytes(), 0644)
+}
+
+// modTimes returns the modification time of each file in the source directory by name.
+func (b *builder) modTimes() (map[string]time.Time, error) {
+	m := make(map[string]time.Time)
+	err := fs.WalkDir(os.DirFS(b.src), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		m[name] = info.ModTime()
+		return nil
+	})
+	return m, err
+}
+
+// watch renders every template, then polls the source directory each interval, updating
+// the output with the files that changed, were added or were removed since.
+func (b *builder) watch(interval time.Duration) error {
+	var mtimes map[string]time.Time
+	for {
+		cur, err := b.modTimes()
+		if err != nil {
+			return err
+		}
+		changed := make(map[string]bool)
+		for name, t := range cur {
+			if prev, ok := mtimes[name]; !ok || !prev.Equal(t) {
+				changed[name] = true
+			}
+		}
+		for name := range mtimes {
+			if _, ok := cur[name]; !ok {
+				changed[name] = true
+			}
+		}
+		mtimes = cur
+		if err := b.update(changed); err != nil {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// update renders the templates that are new or were parsed from a file in changed, and
+// removes the output of templates that were removed. Errors rendering and removing are
+// logged rather than returned so that watching continues once they are fixed.
+func (b *builder) update(changed map[string]bool) error {
+	names, err := b.templates()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if files, ok := b.files[name]; ok && !anyChanged(files, changed) {
+			continue
+		}
+		if err := b.build(name); err != nil {
+			log.Println(err)
+		} else {
+			log.Println("built", b.output(name))
+		}
+	}
+	for _, name := range removed(b.files, names) {
+		delete(b.files, name)
+		if err := os.Remove(b.output(name)); err != nil && !os.IsNotExist(err) {
+			log.Println(err)
+		} else {
+			log.Println("removed", b.output(name))
+		}
+	}
+	return nil
+}
+
+// srcNames returns files, named as read by a DirLoader of the source directory, by their
+// slash-separated paths within it.
+func srcNames(files []string) []string {
+	r := make([]string, len(files))
+	for i, f := range files {
+		r[i] = strings.TrimPrefix(path.Clean(filepath.ToSlash(f)), "/")
+	}
+	return r
+}
+
+// anyChanged reports whether any of files is in changed.
+func anyChanged(files []string, changed map[string]bool) bool {
+	for _, f := range files {
+		if changed[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// removed returns the templates of built that aren't in names, in lexical order.
+func removed(built map[string][]string, names []string) []string {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	var r []string
+	for name := range built {
+		if !keep[name] {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
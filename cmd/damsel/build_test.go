@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_output(t *testing.T) {
+	b := &builder{out: "public"}
+	tests := []struct {
+		name, expect string
+	}{
+		{"index.dmsl", filepath.Join("public", "index.html")},
+		{"blog/post.dmsl", filepath.Join("public", "blog", "post.html")},
+		{"a.b.dmsl", filepath.Join("public", "a.b.html")},
+	}
+	for _, tt := range tests {
+		if r := b.output(tt.name); r != tt.expect {
+			t.Errorf("output(%q) = %q, expected %q", tt.name, r, tt.expect)
+		}
+	}
+}
+
+func Test_anyChanged(t *testing.T) {
+	files := []string{"page.dmsl", "layout/base.dmsl"}
+	tests := []struct {
+		changed map[string]bool
+		expect  bool
+	}{
+		{nil, false},
+		{map[string]bool{"other.dmsl": true}, false},
+		{map[string]bool{"layout/base.dmsl": true}, true},
+		{map[string]bool{"page.dmsl": true, "other.dmsl": true}, true},
+	}
+	for _, tt := range tests {
+		if r := anyChanged(files, tt.changed); r != tt.expect {
+			t.Errorf("anyChanged(%v) = %v, expected %v", tt.changed, r, tt.expect)
+		}
+	}
+}
+
+func Test_srcNames(t *testing.T) {
+	files := []string{"page.dmsl", "./layout/base.dmsl", "/nav.dmsl", "layout/../x.dmsl"}
+	if r, expect := srcNames(files), []string{"page.dmsl", "layout/base.dmsl", "nav.dmsl", "x.dmsl"}; !reflect.DeepEqual(r, expect) {
+		t.Fatalf("expected %v, received %v", expect, r)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Test_update checks a template is rendered again when a file it extends changes, and its
+// output is removed along with it.
+func Test_update(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	src, out := filepath.Join(dir, "src"), filepath.Join(dir, "out")
+	writeFile(t, filepath.Join(src, "layout", "base.dmsl"), "%html %body #content base\n")
+	writeFile(t, filepath.Join(src, "page.dmsl"), ":extends layout/base.dmsl\n\n#content page\n")
+	writeFile(t, filepath.Join(src, "about.dmsl"), "%p about\n")
+
+	b := &builder{src: src, out: out, files: make(map[string][]string)}
+	if err := b.update(nil); err != nil {
+		t.Fatal(err)
+	}
+	if r := readFile(t, b.output("page.dmsl")); r != `<html><body><div id="content">page</div></body></html>` {
+		t.Fatalf("unexpected page %s", r)
+	}
+	if r, expect := b.files["page.dmsl"], []string{"page.dmsl", "layout/base.dmsl"}; !reflect.DeepEqual(r, expect) {
+		t.Fatalf("expected page files %v, received %v", expect, r)
+	}
+
+	writeFile(t, filepath.Join(src, "layout", "base.dmsl"), "%html %body\n\t%h1 title\n\t#content base\n")
+	writeFile(t, b.output("about.dmsl"), "stale")
+	if err := b.update(map[string]bool{"layout/base.dmsl": true}); err != nil {
+		t.Fatal(err)
+	}
+	if r := readFile(t, b.output("page.dmsl")); r != `<html><body><h1>title</h1><div id="content">page</div></body></html>` {
+		t.Fatalf("page not rendered again: %s", r)
+	}
+	if r := readFile(t, b.output("about.dmsl")); r != "stale" {
+		t.Fatalf("unchanged template rendered again: %s", r)
+	}
+
+	if err := os.Remove(filepath.Join(src, "page.dmsl")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.update(map[string]bool{"page.dmsl": true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(b.output("page.dmsl")); !os.IsNotExist(err) {
+		t.Fatalf("output of removed template not removed: %v", err)
+	}
+	if _, ok := b.files["page.dmsl"]; ok {
+		t.Fatal("removed template still tracked")
+	}
+	if _, err := os.Stat(b.output("about.dmsl")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dasa.cc/damsel/convert"
+)
+
+// fromHTML converts the html files named by args, or standard input if there are none,
+// to damsel templates.
+func fromHTML(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the template of file.html to file.dmsl instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: damsel convert [flags] [file.html ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("cannot use -w with standard input")
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		res, err := convert.HTML(src)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+
+	for _, name := range flags.Args() {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		res, err := convert.HTML(src)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if !*write {
+			if _, err := os.Stdout.Write(res); err != nil {
+				return err
+			}
+			continue
+		}
+		out := strings.TrimSuffix(name, filepath.Ext(name)) + ".dmsl"
+		if err := ioutil.WriteFile(out, res, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"dasa.cc/damsel/parse"
+)
+
+// format formats the templates named by args, or standard input if there are none, as
+// gofmt formats Go files. Directories are walked for .dmsl files.
+func format(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	list := flags.Bool("l", false, "list files whose formatting differs from damsel fmt's")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: damsel fmt [flags] [path ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("cannot use -w with standard input")
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		res, err := parse.NewDocParser("<standard input>").Format(src)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+
+	failed := false
+	for _, arg := range flags.Args() {
+		err := filepath.WalkDir(arg, func(name string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				return nil
+			}
+			if err == nil && (name == arg || filepath.Ext(name) == ".dmsl") {
+				err = formatFile(name, *write, *list)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if failed {
+		os.Exit(2)
+	}
+	return nil
+}
+
+// formatFile formats the named file, writing the result to the file if write is set, or
+// to standard output unless list is set, in which case the name is written if the file
+// isn't formatted.
+func formatFile(name string, write, list bool) error {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	res, err := parse.NewDocParser(name).Format(src)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(src, res) {
+		if list {
+			fmt.Println(name)
+		}
+		if write {
+			info, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(name, res, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	if !list && !write {
+		_, err = os.Stdout.Write(res)
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"dasa.cc/damsel"
+	"dasa.cc/damsel/compile"
+)
+
+// gen generates a Go package rendering the templates given as arguments, each optionally
+// followed by =Name to name its render function.
+func gen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	pkg := flags.String("pkg", "views", "name of the generated package")
+	out := flags.String("o", "", "write the generated package to file instead of stdout")
+	dir := flags.String("dir", ".", "directory templates are loaded from")
+	typ := flags.String("type", "", "type of the data given to render functions; interface{} if unset")
+	imports := flags.String("import", "", "comma separated import paths of packages the data type refers to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: damsel gen [flags] file.dmsl[=Name]...")
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "\nFields and methods of the data are looked up by reflection even with -type,")
+		fmt.Fprintln(flags.Output(), "so a misspelled name is an error when rendering, not compiling.")
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	g := compile.NewGenerator(*pkg)
+	if *typ != "" {
+		var paths []string
+		if *imports != "" {
+			paths = strings.Split(*imports, ",")
+		}
+		g.DataType(*typ, paths...)
+	}
+	for _, arg := range flags.Args() {
+		file, name := arg, compile.FuncName(arg)
+		if i := strings.LastIndex(arg, "="); i != -1 {
+			file, name = arg[:i], arg[i+1:]
+		}
+		t := damsel.New().Mode(damsel.Compile).Loader(damsel.DirLoader(*dir))
+		if err := t.ParseFile(file); err != nil {
+			return err
+		}
+		if err := g.Add(name, t); err != nil {
+			return err
+		}
+	}
+	src, err := g.Source()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*out, src, 0644)
+}
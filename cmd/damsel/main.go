@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime/pprof"
@@ -19,9 +20,29 @@ var (
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	data       = flag.String("data", "", "json string to decode as data for template")
 	html       = flag.Bool("html", false, "parses template with html/template pkg; if unset, will be true if data is set")
+	sourcemap  = flag.String("sourcemap", "", "write a json source map of output elements to file")
+	comments   = flag.Bool("sourcecomments", false, "write a comment with the source file and line before each element")
 )
 
+// commands are run in place of parsing a single file when named by the first argument.
+var commands = map[string]func(args []string) error{
+	"gen":     gen,
+	"build":   func(args []string) error { return build(args, false) },
+	"watch":   func(args []string) error { return build(args, true) },
+	"fmt":     format,
+	"convert": fromHTML,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 
 	if *cpuprofile != "" {
@@ -53,6 +74,12 @@ func main() {
 		fmt.Println(r)
 	} else {
 		t, err := damsel.ParseFile(*filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *comments {
+			t.DocMode(parse.SourceComments)
+		}
 
 		var d interface{}
 		if err = json.Unmarshal([]byte(*data), &d); err != nil {
@@ -62,19 +89,29 @@ func main() {
 		}
 
 		if *html || len(*data) > 0 {
-			r, err := damsel.NewHtmlTemplate(t).Execute(d)
-			if err != nil {
-				fmt.Println(err)
-			} else {
-				fmt.Println(r)
-			}
+			err = t.Execute(os.Stdout, d)
+		} else if *sourcemap != "" {
+			err = renderMap(t, *sourcemap)
 		} else {
-			result, err := t.Result()
-			if err != nil {
-				fmt.Println(err)
-			} else {
-				fmt.Println(result)
-			}
+			err = t.Render(os.Stdout)
+		}
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Println()
 		}
 	}
 }
+
+// renderMap writes the document of t to stdout and its source map to filename.
+func renderMap(t *damsel.Template, filename string) error {
+	m, err := t.RenderMap(os.Stdout)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,671 @@
+// Package compile generates Go code rendering damsel templates, so a program can render
+// its templates without parsing them.
+//
+// A template is added to a Generator in damsel's Compile mode, with its extends and
+// includes resolved, and becomes a render function of the generated package:
+//
+//	func Index(w io.Writer, data interface{}) error
+//
+// The static html of the document is written from byte slices computed when the code is
+// generated. Template actions evaluate the fields, methods and functions of data with the
+// semantics of text/template and escape their values as html/template would, with the
+// help of package rt, so a render function writes the same document as executing the
+// template. Actions calling templates defined with define or block are supported where
+// the call is in html text.
+package compile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"unicode"
+	"unicode/utf8"
+
+	"dasa.cc/damsel"
+	"dasa.cc/damsel/compile/rt"
+)
+
+// Generator generates the Go source of a package of render functions.
+type Generator struct {
+	pkg      string
+	dataType string
+	imports  map[string]bool
+	names    map[string]bool
+	decls    bytes.Buffer
+}
+
+// NewGenerator returns a generator of the package named pkg.
+func NewGenerator(pkg string) *Generator {
+	return &Generator{pkg: pkg, dataType: "interface{}", imports: make(map[string]bool), names: make(map[string]bool)}
+}
+
+// DataType sets the type of the data given to the render functions added after, such as
+// "*models.Page", along with the import paths of the packages it refers to. The default
+// is interface{}. Fields and methods of the data are still looked up by reflection as
+// html/template does, so a misspelled name is an error when rendering, not compiling.
+func (g *Generator) DataType(typ string, imports ...string) *Generator {
+	g.dataType = typ
+	for _, path := range imports {
+		g.imports[path] = true
+	}
+	return g
+}
+
+// Add generates the render function name for t, which must be in Compile mode.
+func (g *Generator) Add(name string, t *damsel.Template) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("damsel: invalid function name %q", name)
+	}
+	html, err := t.Compiled()
+	if err != nil {
+		return err
+	}
+	if err := escape(html); err != nil {
+		return err
+	}
+	f := &funcGen{prefix: lowerFirst(name), fns: make(map[string]string)}
+	// the template itself is generated first, followed by those it defines
+	tmpls := html.Templates()
+	sort.SliceStable(tmpls, func(i, j int) bool {
+		return tmpls[i].Name() == html.Name() && tmpls[j].Name() != html.Name()
+	})
+	for _, tmpl := range tmpls {
+		if tmpl.Tree != nil {
+			f.fns[tmpl.Name()] = f.prefix + "Tmpl" + strconv.Itoa(len(f.fns))
+		}
+	}
+	decls := []string{name, f.prefix + "Text"}
+	for _, fn := range f.fns {
+		decls = append(decls, fn)
+	}
+	for _, d := range decls {
+		if g.names[d] {
+			return fmt.Errorf("damsel: generating %s: %s is already declared", name, d)
+		}
+	}
+	var body bytes.Buffer
+	for _, tmpl := range tmpls {
+		if tmpl.Tree == nil {
+			continue
+		}
+		f.tree, f.scopes = tmpl.Tree, nil
+		f.buf.Reset()
+		if err := f.template(tmpl.Tree.Root); err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "\nfunc %s(s *rt.State, dot reflect.Value) {\n", f.fns[tmpl.Name()])
+		if usesRoot(tmpl.Tree.Root) {
+			body.WriteString("root := dot\n")
+		}
+		body.Write(f.buf.Bytes())
+		body.WriteString("}\n")
+	}
+
+	for _, d := range decls {
+		g.names[d] = true
+	}
+	fmt.Fprintf(&g.decls, "\n// %s renders the template %s.\n", name, html.Name())
+	fmt.Fprintf(&g.decls, "func %s(w io.Writer, data %s) error {\n", name, g.dataType)
+	fmt.Fprintf(&g.decls, "return rt.Execute(w, %q, data, %s)\n}\n", html.Name(), f.fns[html.Name()])
+	if len(f.texts) != 0 {
+		fmt.Fprintf(&g.decls, "\nvar %sText = [...][]byte{\n", f.prefix)
+		for _, text := range f.texts {
+			fmt.Fprintf(&g.decls, "[]byte(%s),\n", strconv.Quote(text))
+		}
+		g.decls.WriteString("}\n")
+	}
+	g.decls.Write(body.Bytes())
+	return nil
+}
+
+// Source returns the formatted source of the generated package.
+func (g *Generator) Source() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by damsel gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\nimport (\n\t\"io\"\n\t\"reflect\"\n\n", g.pkg)
+	var imports []string
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&b, "\t%q\n", path)
+	}
+	b.WriteString("\t\"dasa.cc/damsel/compile/rt\"\n)\n")
+	b.Write(g.decls.Bytes())
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("damsel: formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// WriteTo writes the formatted source of the generated package to w.
+func (g *Generator) WriteTo(w io.Writer) (int64, error) {
+	src, err := g.Source()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(src)
+	return int64(n), err
+}
+
+// FuncName returns the name of the render function generated for the named template,
+// an exported identifier made of the words of its path without the extension, such as
+// LayoutBase for layout/base.dmsl.
+func FuncName(name string) string {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) && b.Len() != 0:
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			b.WriteRune(r)
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	if b.Len() == 0 {
+		return "Render"
+	}
+	return b.String()
+}
+
+// escape has html/template escape html, adding escapers to the pipelines of its actions.
+// html/template only does so when executing, which is stopped by the first write. Errors
+// other than those of escaping are those of executing without data, and are ignored.
+func escape(html *template.Template) error {
+	err := html.Execute(failWriter{}, nil)
+	var e *template.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return nil
+}
+
+var errStop = errors.New("stop")
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errStop
+}
+
+// escapers are the rt functions of the escapers html/template adds to pipelines, by the
+// names it calls them. The names aren't part of html/template's API, so Test_escapers
+// checks them for each context html/template escapes values in, and an action escaped
+// by another name is reported as an error rather than written unescaped.
+var escapers = map[string]string{
+	"_html_template_attrescaper":      "AttrEscaper",
+	"_html_template_commentescaper":   "CommentEscaper",
+	"_html_template_cssescaper":       "CSSEscaper",
+	"_html_template_cssvaluefilter":   "CSSValueFilter",
+	"_html_template_htmlnamefilter":   "HTMLNameFilter",
+	"_html_template_htmlescaper":      "HTMLEscaper",
+	"_html_template_jsregexpescaper":  "JSRegexpEscaper",
+	"_html_template_jsstrescaper":     "JSStrEscaper",
+	"_html_template_jstmpllitescaper": "JSTmplLitEscaper",
+	"_html_template_jsvalescaper":     "JSValEscaper",
+	"_html_template_nospaceescaper":   "NospaceEscaper",
+	"_html_template_rcdataescaper":    "RCDATAEscaper",
+	"_html_template_srcsetescaper":    "SrcsetEscaper",
+	"_html_template_urlescaper":       "URLEscaper",
+	"_html_template_urlfilter":        "URLFilter",
+	"_html_template_urlnormalizer":    "URLNormalizer",
+}
+
+// funcGen generates the functions of the templates of a single render function.
+type funcGen struct {
+	prefix string
+	fns    map[string]string // Go function of each template by name
+	texts  []string
+	tree   *parse.Tree
+	scopes []map[string]bool // variables declared by each Go block
+	buf    bytes.Buffer
+	err    error
+}
+
+func (f *funcGen) errorf(n parse.Node, format string, args ...interface{}) {
+	if f.err == nil {
+		loc, _ := f.tree.ErrorContext(n)
+		f.err = fmt.Errorf("damsel: %s: %s", loc, fmt.Sprintf(format, args...))
+	}
+}
+
+func (f *funcGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&f.buf, format, args...)
+}
+
+func (f *funcGen) template(root *parse.ListNode) error {
+	f.err = nil
+	f.block(func() { f.list(root) })
+	return f.err
+}
+
+// block generates a Go block with the code of fn.
+func (f *funcGen) block(fn func()) {
+	f.scopes = append(f.scopes, make(map[string]bool))
+	fn()
+	f.scopes = f.scopes[:len(f.scopes)-1]
+}
+
+func (f *funcGen) list(l *parse.ListNode) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		f.node(n)
+	}
+}
+
+func (f *funcGen) node(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.TextNode:
+		f.printf("s.Write(%sText[%d])\n", f.prefix, f.text(string(n.Text)))
+	case *parse.ActionNode:
+		f.action(n)
+	case *parse.IfNode:
+		f.ifOrWith(&n.BranchNode, false)
+	case *parse.WithNode:
+		f.ifOrWith(&n.BranchNode, true)
+	case *parse.RangeNode:
+		f.rangeNode(n)
+	case *parse.TemplateNode:
+		fn, ok := f.fns[n.Name]
+		if !ok {
+			f.errorf(n, "template %q called outside of html text is not supported", n.Name)
+			return
+		}
+		f.printf("{\n")
+		f.block(func() {
+			val := "reflect.Value{}"
+			if n.Pipe != nil {
+				val = f.pipe(n.Pipe)
+			}
+			f.printf("s.Template(%s, %s)\n", fn, val)
+		})
+		f.printf("}\n")
+	case *parse.BreakNode:
+		f.printf("break\n")
+	case *parse.ContinueNode:
+		f.printf("continue\n")
+	case *parse.CommentNode:
+	default:
+		f.errorf(n, "unknown node: %s", n)
+	}
+}
+
+// text returns the index of the static text s.
+func (f *funcGen) text(s string) int {
+	for i, t := range f.texts {
+		if t == s {
+			return i
+		}
+	}
+	f.texts = append(f.texts, s)
+	return len(f.texts) - 1
+}
+
+func (f *funcGen) action(n *parse.ActionNode) {
+	if len(n.Pipe.Decl) != 0 {
+		f.pipe(n.Pipe)
+		return
+	}
+	cmds := n.Pipe.Cmds
+	var chain []string
+	for len(cmds) > 1 {
+		last := cmds[len(cmds)-1]
+		id, ok := last.Args[0].(*parse.IdentifierNode)
+		if !ok || len(last.Args) != 1 || !strings.HasPrefix(id.Ident, "_html_template_") {
+			break
+		}
+		fn, ok := escapers[id.Ident]
+		if !ok {
+			f.errorf(n, "no escaper for %s", id.Ident)
+			return
+		}
+		chain = append(chain, fn)
+		cmds = cmds[:len(cmds)-1]
+	}
+	val := f.commands(cmds)
+	if len(chain) == 0 {
+		f.printf("s.Print(%s)\n", val)
+		return
+	}
+	val = "rt.Interface(" + val + ")"
+	for i := len(chain) - 1; i >= 0; i-- {
+		val = "rt." + chain[i] + "(" + val + ")"
+	}
+	f.printf("s.WriteString(%s)\n", val)
+}
+
+func (f *funcGen) ifOrWith(n *parse.BranchNode, with bool) {
+	f.printf("{\n")
+	f.block(func() {
+		f.printf("val := %s\n", f.pipe(n.Pipe))
+		f.printf("if s.True(val) {\n")
+		f.block(func() {
+			if with {
+				f.printf("saved := dot\ndot = val\n")
+			}
+			f.list(n.List)
+			if with {
+				f.printf("dot = saved\n")
+			}
+		})
+		if n.ElseList != nil {
+			f.printf("} else {\n")
+			f.block(func() { f.list(n.ElseList) })
+		}
+		f.printf("}\n")
+	})
+	f.printf("}\n")
+}
+
+func (f *funcGen) rangeNode(n *parse.RangeNode) {
+	decl := n.Pipe.Decl
+	f.printf("{\n")
+	f.block(func() {
+		f.printf("it := s.Range(%s, %d)\nsaved := dot\n", f.pipe(n.Pipe), len(decl))
+		f.printf("for it.Next() {\n")
+		f.block(func() {
+			f.printf("dot = it.Elem()\n")
+			switch len(decl) {
+			case 1:
+				f.printf("%s = it.Elem()\n", f.variable(decl[0].Ident[0]))
+			case 2:
+				f.printf("%s, %s = it.Index(), it.Elem()\n", f.variable(decl[0].Ident[0]), f.variable(decl[1].Ident[0]))
+			}
+			f.list(n.List)
+		})
+		f.printf("}\nit.Stop()\ndot = saved\n")
+		if n.ElseList != nil {
+			f.printf("if it.Empty() {\n")
+			f.block(func() { f.list(n.ElseList) })
+			f.printf("}\n")
+		}
+	})
+	f.printf("}\n")
+}
+
+// pipe returns an expression of the value of pipe, declaring or assigning its variables.
+func (f *funcGen) pipe(pipe *parse.PipeNode) string {
+	val := f.commands(pipe.Cmds)
+	if len(pipe.Decl) == 0 {
+		return val
+	}
+	first := f.variable(pipe.Decl[0].Ident[0])
+	for i, v := range pipe.Decl {
+		name := v.Ident[0]
+		if i > 0 {
+			val = first
+		}
+		scope := f.scopes[len(f.scopes)-1]
+		if pipe.IsAssign || scope[name] {
+			f.printf("%s = %s\n", f.variable(name), val)
+		} else {
+			scope[name] = true
+			f.printf("%s := %s\n_ = %[1]s\n", f.variable(name), val)
+		}
+	}
+	return first
+}
+
+// commands returns an expression of the value of the commands of a pipeline, each
+// given the value of the one before as its final argument.
+func (f *funcGen) commands(cmds []*parse.CommandNode) string {
+	val := "rt.Missing"
+	for _, cmd := range cmds {
+		val = f.command(cmd, val)
+	}
+	return val
+}
+
+func (f *funcGen) command(cmd *parse.CommandNode, final string) string {
+	args := f.args(cmd.Args[1:], false)
+	switch n := cmd.Args[0].(type) {
+	case *parse.FieldNode:
+		return fmt.Sprintf("rt.Dig(s.Field(dot, %s, %s%s))", quoteList(n.Ident), final, args)
+	case *parse.ChainNode:
+		if n.Node.Type() == parse.NodeNil {
+			return f.fail(fmt.Sprintf("indirection through explicit nil in %s", n))
+		}
+		return fmt.Sprintf("rt.Dig(s.Field(%s, %s, %s%s))", f.operand(n.Node), quoteList(n.Field), final, args)
+	case *parse.IdentifierNode:
+		return "rt.Dig(" + f.call(n, cmd.Args[1:], final) + ")"
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 {
+			return fmt.Sprintf("rt.Dig(s.Field(%s, %s, %s%s))", f.variable(n.Ident[0]), quoteList(n.Ident[1:]), final, args)
+		}
+	}
+	if len(cmd.Args) > 1 || final != "rt.Missing" {
+		return f.fail(fmt.Sprintf("can't give argument to non-function %s", cmd.Args[0]))
+	}
+	switch n := cmd.Args[0].(type) {
+	case *parse.PipeNode:
+		return f.nested(n)
+	case *parse.VariableNode:
+		return f.variable(n.Ident[0])
+	case *parse.BoolNode:
+		return fmt.Sprintf("reflect.ValueOf(%t)", n.True)
+	case *parse.DotNode:
+		return "rt.Dig(dot)"
+	case *parse.NilNode:
+		return f.fail("nil is not a command")
+	case *parse.NumberNode:
+		return f.number(n)
+	case *parse.StringNode:
+		return fmt.Sprintf("reflect.ValueOf(%s)", strconv.Quote(n.Text))
+	}
+	f.errorf(cmd, "can't evaluate command %q", cmd.Args[0])
+	return "reflect.Value{}"
+}
+
+// call returns an expression calling the function n with args and final.
+func (f *funcGen) call(n *parse.IdentifierNode, args []parse.Node, final string) string {
+	if !rt.IsFunc(n.Ident) {
+		f.errorf(n, "%q is not a defined function", n.Ident)
+	}
+	lazy := n.Ident == "and" || n.Ident == "or"
+	if n.Ident == "call" && len(args) != 0 {
+		return fmt.Sprintf("s.CallFunc(%q, %s%s)", args[0].String(), final, f.args(args, lazy))
+	}
+	return fmt.Sprintf("s.Call(%q, %s%s)", n.Ident, final, f.args(args, lazy))
+}
+
+// args returns the arguments of a call, each preceded by a comma.
+func (f *funcGen) args(args []parse.Node, lazy bool) string {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(", ")
+		b.WriteString(f.arg(arg, lazy))
+	}
+	return b.String()
+}
+
+func (f *funcGen) arg(n parse.Node, lazy bool) string {
+	switch n := n.(type) {
+	case *parse.NilNode:
+		return "rt.Nil{}"
+	case *parse.BoolNode:
+		return fmt.Sprintf("rt.Bool(%t)", n.True)
+	case *parse.StringNode:
+		return fmt.Sprintf("rt.String(%s)", strconv.Quote(n.Text))
+	case *parse.NumberNode:
+		return numberArg(n)
+	}
+	if lazy {
+		return "rt.Lazy(func() reflect.Value { return " + f.operand(n) + " })"
+	}
+	return "rt.Val(" + f.operand(n) + ")"
+}
+
+// numberArg returns an rt.Number of each representation of n.
+func numberArg(n *parse.NumberNode) string {
+	fields := []string{"Text: " + strconv.Quote(n.Text)}
+	if n.IsInt {
+		fields = append(fields, "IsInt: true", "Int: "+strconv.FormatInt(n.Int64, 10))
+	}
+	if n.IsUint {
+		fields = append(fields, "IsUint: true", "Uint: "+strconv.FormatUint(n.Uint64, 10))
+	}
+	if n.IsFloat {
+		fields = append(fields, "IsFloat: true", "Float: "+float(n.Float64))
+	}
+	if n.IsComplex {
+		fields = append(fields, "IsComplex: true", "Complex: "+complexLit(n.Complex128))
+	}
+	return "rt.Number{" + strings.Join(fields, ", ") + "}"
+}
+
+// operand returns an expression of the value of n, an argument or the start of a chain,
+// such as (.X).Y.
+func (f *funcGen) operand(n parse.Node) string {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return "dot"
+	case *parse.FieldNode:
+		return fmt.Sprintf("s.Field(dot, %s, rt.Missing)", quoteList(n.Ident))
+	case *parse.VariableNode:
+		if len(n.Ident) == 1 {
+			return f.variable(n.Ident[0])
+		}
+		return fmt.Sprintf("s.Field(%s, %s, rt.Missing)", f.variable(n.Ident[0]), quoteList(n.Ident[1:]))
+	case *parse.PipeNode:
+		return f.nested(n)
+	case *parse.IdentifierNode:
+		return f.call(n, nil, "rt.Missing")
+	case *parse.ChainNode:
+		return fmt.Sprintf("s.Field(%s, %s, rt.Missing)", f.operand(n.Node), quoteList(n.Field))
+	}
+	f.errorf(n, "can't handle %s as an operand", n)
+	return "reflect.Value{}"
+}
+
+// nested returns an expression of the value of a parenthesized pipeline.
+func (f *funcGen) nested(pipe *parse.PipeNode) string {
+	if len(pipe.Decl) != 0 {
+		f.errorf(pipe, "variable declared in parenthesized pipeline %s is not supported", pipe)
+	}
+	return f.commands(pipe.Cmds)
+}
+
+// number returns an expression of the value of a number where its type isn't known.
+func (f *funcGen) number(n *parse.NumberNode) string {
+	switch {
+	case n.IsComplex:
+		return "reflect.ValueOf(" + complexLit(n.Complex128) + ")"
+	case n.IsFloat && !isHexInt(n.Text) && !strings.HasPrefix(n.Text, "'") && strings.ContainsAny(n.Text, ".eEpP"):
+		return "reflect.ValueOf(" + float(n.Float64) + ")"
+	case n.IsInt:
+		return fmt.Sprintf("reflect.ValueOf(int(%d))", n.Int64)
+	case n.IsUint:
+		return f.fail(n.Text + " overflows int")
+	}
+	return "reflect.Value{}"
+}
+
+func isHexInt(s string) bool {
+	return len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && !strings.ContainsAny(s, "pP")
+}
+
+// fail returns an expression stopping execution with the error msg.
+func (f *funcGen) fail(msg string) string {
+	return fmt.Sprintf("s.Error(%q)", strings.ReplaceAll(msg, "%", "%%"))
+}
+
+// variable returns the Go variable of the template variable name.
+func (f *funcGen) variable(name string) string {
+	if name == "$" {
+		return "root"
+	}
+	return "v_" + name[1:]
+}
+
+// usesRoot reports whether the variable $ is referred to by n or the nodes it holds.
+func usesRoot(n parse.Node) bool {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Nodes {
+			if usesRoot(c) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesRoot(n.Pipe)
+	case *parse.IfNode:
+		return usesRoot(n.Pipe) || usesRoot(n.List) || usesRoot(n.ElseList)
+	case *parse.WithNode:
+		return usesRoot(n.Pipe) || usesRoot(n.List) || usesRoot(n.ElseList)
+	case *parse.RangeNode:
+		return usesRoot(n.Pipe) || usesRoot(n.List) || usesRoot(n.ElseList)
+	case *parse.TemplateNode:
+		return n.Pipe != nil && usesRoot(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if usesRoot(arg) {
+					return true
+				}
+			}
+		}
+	case *parse.VariableNode:
+		return n.Ident[0] == "$"
+	case *parse.ChainNode:
+		return usesRoot(n.Node)
+	}
+	return false
+}
+
+func float(x float64) string {
+	return "float64(" + strconv.FormatFloat(x, 'g', -1, 64) + ")"
+}
+
+func complexLit(c complex128) string {
+	return "complex(" + float(real(c)) + ", " + float(imag(c)) + ")"
+}
+
+func quoteList(list []string) string {
+	return "[]string{" + quoteArgs(list) + "}"
+}
+
+func quoteArgs(list []string) string {
+	q := make([]string, len(list))
+	for i, s := range list {
+		q[i] = strconv.Quote(s)
+	}
+	return strings.Join(q, ", ")
+}
+
+// isIdentifier reports whether name is a valid Go identifier.
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
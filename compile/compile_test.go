@@ -0,0 +1,221 @@
+package compile
+
+import (
+	"bytes"
+	"flag"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template/parse"
+
+	"dasa.cc/damsel"
+	"dasa.cc/damsel/compile/internal/gentest"
+)
+
+var update = flag.Bool("update", false, "update the generated package internal/gentest")
+
+const gentestFile = "internal/gentest/gentest.go"
+
+// genTests are the templates generated to package gentest, the test pairs of the damsel
+// package and the features of templates the generated code supports.
+var genTests = []struct {
+	dir, name string
+}{
+	{"../tests", "html"},
+	{"../tests", "indent"},
+	{"../tests", "variable_indent"},
+	{"../tests", "inline"},
+	{"../tests", "multiline_text"},
+	{"../tests", "tabs"},
+	{"../tests", "tag_hashes"},
+	{"../tests", "extends"},
+	{"../tests", "extends_super"},
+	{"../tests", "bigtable"},
+	{"testdata", "features"},
+}
+
+func parseFile(t *testing.T, dir, name string) *damsel.Template {
+	tpl := damsel.New().Mode(damsel.Compile).Loader(damsel.DirLoader(dir))
+	if err := tpl.ParseFile(name + ".dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	return tpl
+}
+
+func generate(t *testing.T) []byte {
+	g := NewGenerator("gentest")
+	for _, tt := range genTests {
+		if err := g.Add(FuncName(tt.name), parseFile(t, tt.dir, tt.name)); err != nil {
+			t.Fatal(tt.name, err)
+		}
+	}
+	src, err := g.Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func Test_generate(t *testing.T) {
+	src := generate(t)
+	if *update {
+		if err := os.WriteFile(gentestFile, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(gentestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, src) {
+		t.Fatalf("%s is out of date, run go test -update", gentestFile)
+	}
+}
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func (u *user) Greet(s string) string {
+	return s + ", " + u.Name
+}
+
+type features struct {
+	Title, Color, Link, Query, Empty string
+
+	User  *user
+	Items []string
+	Map   map[string]interface{}
+	Pi    float64
+	HTML  template.HTML
+	Nil   *int
+	None  []int
+}
+
+// render checks the render function of the template name renders data as executing the
+// template does, and as its html test pair if it has one.
+func render(t *testing.T, dir, name string, fn func(io.Writer, interface{}) error, data interface{}) {
+	var expect, buf bytes.Buffer
+	err := parseFile(t, dir, name).Execute(&expect, data)
+	if rerr := fn(&buf, data); (err == nil) != (rerr == nil) {
+		t.Fatalf("%s: render error %v, expected %v", name, rerr, err)
+	}
+	if err != nil {
+		return
+	}
+	if r := buf.String(); r != expect.String() {
+		t.Fatalf("%s: render differs from execute\nExpected\n========\n%s\nReceived\n========\n%s", name, expect.String(), r)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, name+".html")); err == nil {
+		if html, r := strings.TrimSpace(string(b)), strings.TrimSpace(buf.String()); r != html {
+			t.Fatalf("%s: render differs from html\nExpected\n========\n%s\nReceived\n========\n%s", name, html, r)
+		}
+	}
+}
+
+func Test_render(t *testing.T) {
+	letters := []string{"a", "b", "c", "d"}
+	render(t, "../tests", "html", gentest.Html, nil)
+	render(t, "../tests", "indent", gentest.Indent, nil)
+	render(t, "../tests", "variable_indent", gentest.VariableIndent, nil)
+	render(t, "../tests", "inline", gentest.Inline, letters)
+	render(t, "../tests", "multiline_text", gentest.MultilineText, nil)
+	render(t, "../tests", "tabs", gentest.Tabs, nil)
+	render(t, "../tests", "tag_hashes", gentest.TagHashes, nil)
+	render(t, "../tests", "extends", gentest.Extends, nil)
+	render(t, "../tests", "extends_super", gentest.ExtendsSuper, nil)
+	render(t, "../tests", "bigtable", gentest.Bigtable, [2][10]int{})
+}
+
+func Test_render_features(t *testing.T) {
+	tests := []interface{}{
+		features{
+			Title: "T",
+			Color: "red",
+			Link:  "/a b",
+			Query: "x&y",
+			User:  &user{"Ann", 30},
+			Items: []string{"a", "bb", "ccc", "dddd", "e", "f", "g"},
+			Map:   map[string]interface{}{"a": 1, "b": "two"},
+			Pi:    3.14159,
+			HTML:  "<em>html</em>",
+		},
+		features{
+			Title: `"T" <&> 'q'`,
+			Color: "expression(x)",
+			Link:  "javascript:alert(1)",
+			Query: "a b+c",
+			User:  &user{"O'Brien</script>", -1},
+			Items: []string{"<", ">"},
+			Map:   map[string]interface{}{},
+			HTML:  "<b>",
+			Empty: "e",
+		},
+		// the rest fail to execute, and must fail to render
+		features{},
+		map[string]interface{}{"Title": "map", "User": map[string]interface{}{"Name": "M"}},
+		nil,
+		features{Items: []string{"a"}},
+		map[string]interface{}{"Title": 1, "Items": []int{1, 2}},
+	}
+	for _, data := range tests {
+		render(t, "testdata", "features", gentest.Features, data)
+	}
+}
+
+func Test_FuncName(t *testing.T) {
+	tests := []struct {
+		name, expect string
+	}{
+		{"index.dmsl", "Index"},
+		{"variable_indent.dmsl", "VariableIndent"},
+		{"layout/base.dmsl", "LayoutBase"},
+		{"2col-page.dmsl", "ColPage"},
+		{"", "Render"},
+	}
+	for _, tt := range tests {
+		if r := FuncName(tt.name); r != tt.expect {
+			t.Errorf("FuncName(%q) = %q, expected %q", tt.name, r, tt.expect)
+		}
+	}
+}
+
+// Test_escapers checks escape adds to actions in each context html/template escapes values
+// in only escapers with a function in package rt, so a change to the names html/template
+// gives its escapers is caught here.
+func Test_escapers(t *testing.T) {
+	src := `<p title="{{.}}" class={{.}} {{.}}="" onclick="f({{.}}, '{{.}}', /{{.}}/)" style="color: {{.}}">{{.}}</p>` +
+		`<a href="{{.}}" data-x=/{{.}}>x</a><a href="/?q={{.}}">y</a><img srcset="{{.}}"><textarea>{{.}}</textarea>` +
+		"<script>var a = {{.}}, b = \"{{.}}\", c = `{{.}}`;</script>" +
+		`<style>p { color: {{.}}; font-family: "{{.}}"; background: url({{.}}) url(/?{{.}}) }</style>`
+	html := template.Must(template.New("escapers").Parse(src))
+	if err := escape(html); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, n := range html.Tree.Root.Nodes {
+		a, ok := n.(*parse.ActionNode)
+		if !ok {
+			continue
+		}
+		for _, cmd := range a.Pipe.Cmds[1:] {
+			id, ok := cmd.Args[0].(*parse.IdentifierNode)
+			if !ok {
+				t.Fatalf("unexpected command %s", cmd)
+			}
+			if _, ok := escapers[id.Ident]; !ok {
+				t.Fatalf("no rt function for escaper %s", id.Ident)
+			}
+			seen[id.Ident] = true
+		}
+	}
+	for name := range escapers {
+		if !seen[name] && name != "_html_template_commentescaper" {
+			t.Errorf("escaper %s not seen", name)
+		}
+	}
+}
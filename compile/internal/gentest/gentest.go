@@ -0,0 +1,385 @@
+// Code generated by damsel gen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"io"
+	"reflect"
+
+	"dasa.cc/damsel/compile/rt"
+)
+
+// Html renders the template html.dmsl.
+func Html(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "html.dmsl", data, htmlTmpl0)
+}
+
+var htmlText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><body><h1>Basic HTML Test</h1><p><a>Hello World</a></p><div><span><p><a>Anchor Element</a></p></span></div><div>One<div>Two<div>Three</div></div></div></body></html>"),
+}
+
+func htmlTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(htmlText[0])
+}
+
+// Indent renders the template indent.dmsl.
+func Indent(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "indent.dmsl", data, indentTmpl0)
+}
+
+var indentText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><head><title></title><link><script></script></head><body><div><h1></h1></div><span><strong></strong><p><a></a><em></em><img></p><div><img><em></em><a></a></div></span><strong></strong></body></html>"),
+}
+
+func indentTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(indentText[0])
+}
+
+// VariableIndent renders the template variable_indent.dmsl.
+func VariableIndent(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "variable_indent.dmsl", data, variableIndentTmpl0)
+}
+
+var variableIndentText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><head><title></title><link><script></script></head><body><div><h1></h1></div><span><strong></strong><p><a></a><em></em><img></p><div><img><em></em><a></a></div></span><strong></strong></body></html>"),
+}
+
+func variableIndentTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(variableIndentText[0])
+}
+
+// Inline renders the template inline.dmsl.
+func Inline(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "inline.dmsl", data, inlineTmpl0)
+}
+
+var inlineText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><body><div id=\"filler\"><div id=\"side1\"><div id=\"box1\"></div></div></div><div id=\"wrapper\"><div id=\"container\"><div id=\"top\"><h2><a href=\"/\">Hello World</a></h2><ul class=\"company_info\"><li><a href=\"/\">Home</a></li><li><a href=\"/contact\">Contact</a></li><li><a href=\"/about\">About Us</a></li><li><a href=\"/more\">More Info</a></li></ul><ul>"),
+	[]byte("<li>"),
+	[]byte("</li>"),
+	[]byte("</ul></div></div></div></body></html>"),
+}
+
+func inlineTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(inlineText[0])
+	{
+		it := s.Range(rt.Dig(dot), 0)
+		saved := dot
+		for it.Next() {
+			dot = it.Elem()
+			s.Write(inlineText[1])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(dot))))
+			s.Write(inlineText[2])
+		}
+		it.Stop()
+		dot = saved
+	}
+	s.Write(inlineText[3])
+}
+
+// MultilineText renders the template multiline_text.dmsl.
+func MultilineText(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "multiline_text.dmsl", data, multilineTextTmpl0)
+}
+
+var multilineTextText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><body><p>This is a test of multiline text that includes head text with some <span>middle content that also has multiline text</span> and some tail text for the element.</p><div id=\"footer\"></div></body></html>"),
+}
+
+func multilineTextTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(multilineTextText[0])
+}
+
+// Tabs renders the template tabs.dmsl.
+func Tabs(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "tabs.dmsl", data, tabsTmpl0)
+}
+
+var tabsText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><head><title>Hello Tabs!</title></head><body><h1>Tabs and Spam!</h1></body></html>"),
+}
+
+func tabsTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(tabsText[0])
+}
+
+// TagHashes renders the template tag_hashes.dmsl.
+func TagHashes(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "tag_hashes.dmsl", data, tagHashesTmpl0)
+}
+
+var tagHashesText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><body><div id=\"header\" class=\"top\" cookies=\"yes\"></div><tag id=\"id\" class=\"class class\" more=\"less\" some=\"little\"></tag><tag id=\"id\" class=\"class class\" always=\"never\" no=\"yes\"></tag><tag id=\"id\" class=\"class class\"></tag><div id=\"id\" class=\"class class\"></div><div id=\"id\"></div><div class=\"class\" who=\"what\" where=\"when\"></div><h1 id=\"good\" class=\"big\" attr1=\"val1\" attr2=\"val2\"></h1><p id=\"id1\" class=\"class1 class2 class3\"></p><div id=\"id2\" class=\"class1 class2\" attr1=\"val1\" attr2=\"val2\"></div><div id=\"places\" attr=\"val1\" attr2=\"val2\" attr3=\"val3\"></div></body></html>"),
+}
+
+func tagHashesTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(tagHashesText[0])
+}
+
+// Extends renders the template extends.dmsl.
+func Extends(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "extends.dmsl", data, extendsTmpl0)
+}
+
+var extendsText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><body><div id=\"content\"><span>Two</span></div></body></html>"),
+}
+
+func extendsTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(extendsText[0])
+}
+
+// ExtendsSuper renders the template extends_super.dmsl.
+func ExtendsSuper(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "extends_super.dmsl", data, extendsSuperTmpl0)
+}
+
+var extendsSuperText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><body><div id=\"content\"><span>One</span><span>Two</span></div></body></html>"),
+}
+
+func extendsSuperTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(extendsSuperText[0])
+}
+
+// Bigtable renders the template bigtable.dmsl.
+func Bigtable(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "bigtable.dmsl", data, bigtableTmpl0)
+}
+
+var bigtableText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<table>"),
+	[]byte("<tr>"),
+	[]byte("<td>"),
+	[]byte("</td>"),
+	[]byte("</tr>"),
+	[]byte("</table>"),
+}
+
+func bigtableTmpl0(s *rt.State, dot reflect.Value) {
+	s.Write(bigtableText[0])
+	{
+		it := s.Range(rt.Dig(dot), 0)
+		saved := dot
+		for it.Next() {
+			dot = it.Elem()
+			s.Write(bigtableText[1])
+			{
+				it := s.Range(rt.Dig(dot), 0)
+				saved := dot
+				for it.Next() {
+					dot = it.Elem()
+					s.Write(bigtableText[2])
+					s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(dot))))
+					s.Write(bigtableText[3])
+				}
+				it.Stop()
+				dot = saved
+			}
+			s.Write(bigtableText[4])
+		}
+		it.Stop()
+		dot = saved
+	}
+	s.Write(bigtableText[5])
+}
+
+// Features renders the template features.dmsl.
+func Features(w io.Writer, data interface{}) error {
+	return rt.Execute(w, "features.dmsl", data, featuresTmpl0)
+}
+
+var featuresText = [...][]byte{
+	[]byte("<!DOCTYPE html>\n<html><head><title>"),
+	[]byte("</title><script>var user = "),
+	[]byte(", s = \""),
+	[]byte("\";</script></head><body><h1 title=\""),
+	[]byte("\" style=\"color:"),
+	[]byte("\">"),
+	[]byte("</h1><a href=\""),
+	[]byte("\">link</a><a href=\"/search?q="),
+	[]byte("\">search</a>"),
+	[]byte("<p class=\"user\">"),
+	[]byte(" is "),
+	[]byte("</p>"),
+	[]byte("<p>nobody</p>"),
+	[]byte("<ul>"),
+	[]byte("<li class=\"item-"),
+	[]byte(" "),
+	[]byte("</li>"),
+	[]byte("<li>none</li>"),
+	[]byte("</ul><dl>"),
+	[]byte("<dt>"),
+	[]byte("</dt><dd>"),
+	[]byte("</dd>"),
+	[]byte("</dl><p>"),
+	[]byte("</p><p>"),
+	[]byte("<p>"),
+	[]byte("x"),
+	[]byte("none"),
+	[]byte("</p></body></html>"),
+	[]byte("<b>"),
+	[]byte("</b>"),
+}
+
+func featuresTmpl0(s *rt.State, dot reflect.Value) {
+	root := dot
+	s.Write(featuresText[0])
+	s.WriteString(rt.RCDATAEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Title"}, rt.Missing)))))
+	s.Write(featuresText[1])
+	s.WriteString(rt.JSValEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"User", "Name"}, rt.Missing)))))
+	s.Write(featuresText[2])
+	s.WriteString(rt.JSStrEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"User", "Name"}, rt.Missing)))))
+	s.Write(featuresText[3])
+	s.WriteString(rt.AttrEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Title"}, rt.Missing)))))
+	s.Write(featuresText[4])
+	s.WriteString(rt.AttrEscaper(rt.CSSValueFilter(rt.Interface(rt.Dig(s.Field(dot, []string{"Color"}, rt.Missing))))))
+	s.Write(featuresText[5])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Title"}, rt.Missing)))))
+	s.Write(featuresText[6])
+	s.WriteString(rt.AttrEscaper(rt.URLNormalizer(rt.URLFilter(rt.Interface(rt.Dig(s.Field(dot, []string{"Link"}, rt.Missing)))))))
+	s.Write(featuresText[7])
+	s.WriteString(rt.AttrEscaper(rt.URLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Query"}, rt.Missing))))))
+	s.Write(featuresText[8])
+	{
+		val := rt.Dig(s.Field(dot, []string{"User"}, rt.Missing))
+		if s.True(val) {
+			saved := dot
+			dot = val
+			s.Write(featuresText[9])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Name"}, rt.Missing)))))
+			s.Write(featuresText[10])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Age"}, rt.Missing)))))
+			s.Write(featuresText[11])
+			dot = saved
+		} else {
+			s.Write(featuresText[12])
+		}
+	}
+	s.Write(featuresText[13])
+	{
+		v_i := rt.Dig(s.Field(dot, []string{"Items"}, rt.Missing))
+		_ = v_i
+		v_e := v_i
+		_ = v_e
+		it := s.Range(v_i, 2)
+		saved := dot
+		for it.Next() {
+			dot = it.Elem()
+			v_i, v_e = it.Index(), it.Elem()
+			{
+				val := rt.Dig(s.Call("eq", rt.Missing, rt.Val(v_i), rt.Number{Text: "2", IsInt: true, Int: 2, IsUint: true, Uint: 2, IsFloat: true, Float: float64(2)}))
+				if s.True(val) {
+					continue
+				}
+			}
+			{
+				val := rt.Dig(s.Call("gt", rt.Missing, rt.Val(v_i), rt.Number{Text: "4", IsInt: true, Int: 4, IsUint: true, Uint: 4, IsFloat: true, Float: float64(4)}))
+				if s.True(val) {
+					break
+				}
+			}
+			s.Write(featuresText[14])
+			s.WriteString(rt.AttrEscaper(rt.Interface(v_i)))
+			s.Write(featuresText[5])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(v_e)))
+			s.Write(featuresText[15])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("len", rt.Missing, rt.Val(v_e))))))
+			s.Write(featuresText[15])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(root, []string{"Title"}, rt.Missing)))))
+			s.Write(featuresText[16])
+		}
+		it.Stop()
+		dot = saved
+		if it.Empty() {
+			s.Write(featuresText[17])
+		}
+	}
+	s.Write(featuresText[18])
+	{
+		v_k := rt.Dig(s.Field(dot, []string{"Map"}, rt.Missing))
+		_ = v_k
+		v_v := v_k
+		_ = v_v
+		it := s.Range(v_k, 2)
+		saved := dot
+		for it.Next() {
+			dot = it.Elem()
+			v_k, v_v = it.Index(), it.Elem()
+			s.Write(featuresText[19])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(v_k)))
+			s.Write(featuresText[20])
+			s.WriteString(rt.HTMLEscaper(rt.Interface(v_v)))
+			s.Write(featuresText[21])
+		}
+		it.Stop()
+		dot = saved
+	}
+	s.Write(featuresText[22])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("printf", rt.Missing, rt.String("%05.1f"), rt.Val(s.Field(dot, []string{"Pi"}, rt.Missing)))))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"User", "Greet"}, rt.Missing, rt.String("hi"))))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("index", rt.Missing, rt.Val(s.Field(dot, []string{"Items"}, rt.Missing)), rt.Number{Text: "1", IsInt: true, Int: 1, IsUint: true, Uint: 1, IsFloat: true, Float: float64(1)})))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"HTML"}, rt.Missing)))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("and", rt.Missing, rt.Lazy(func() reflect.Value { return s.Field(dot, []string{"Empty"}, rt.Missing) }), rt.String("x"))))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("or", rt.Missing, rt.Lazy(func() reflect.Value { return s.Field(dot, []string{"Empty"}, rt.Missing) }), rt.String("y"))))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("not", rt.Missing, rt.Val(s.Field(dot, []string{"Empty"}, rt.Missing)))))))
+	s.Write(featuresText[23])
+	v_x := reflect.ValueOf(int(3))
+	_ = v_x
+	s.WriteString(rt.HTMLEscaper(rt.Interface(v_x)))
+	v_x = reflect.ValueOf(int(4))
+	s.WriteString(rt.HTMLEscaper(rt.Interface(v_x)))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("Mod", rt.Missing, rt.Number{Text: "4", IsInt: true, Int: 4, IsUint: true, Uint: 4, IsFloat: true, Float: float64(4)}, rt.Number{Text: "2", IsInt: true, Int: 2, IsUint: true, Uint: 2, IsFloat: true, Float: float64(2)})))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Call("StrEq", rt.Missing, rt.Val(s.Field(dot, []string{"Title"}, rt.Missing)), rt.String("T"))))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Map", "zzz"}, rt.Missing)))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Map", "a"}, rt.Missing)))))
+	s.Write(featuresText[15])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(s.Field(dot, []string{"Nil"}, rt.Missing)))))
+	s.Write(featuresText[11])
+	s.Write(featuresText[24])
+	{
+		s.Template(featuresTmpl1, rt.Dig(s.Field(dot, []string{"Title"}, rt.Missing)))
+	}
+	s.Write(featuresText[23])
+	{
+		it := s.Range(reflect.ValueOf(int(3)), 0)
+		saved := dot
+		for it.Next() {
+			dot = it.Elem()
+			s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(dot))))
+		}
+		it.Stop()
+		dot = saved
+	}
+	s.Write(featuresText[15])
+	{
+		it := s.Range(rt.Dig(s.Field(dot, []string{"None"}, rt.Missing)), 0)
+		saved := dot
+		for it.Next() {
+			dot = it.Elem()
+			s.Write(featuresText[25])
+		}
+		it.Stop()
+		dot = saved
+		if it.Empty() {
+			s.Write(featuresText[26])
+		}
+	}
+	s.Write(featuresText[27])
+}
+
+func featuresTmpl1(s *rt.State, dot reflect.Value) {
+	s.Write(featuresText[28])
+	s.WriteString(rt.HTMLEscaper(rt.Interface(rt.Dig(dot))))
+	s.Write(featuresText[29])
+}
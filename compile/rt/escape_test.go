@@ -0,0 +1,208 @@
+package rt
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template/parse"
+)
+
+// probes are documents with a single action that html/template escapes with the chain of
+// escapers each is keyed by.
+var probes = map[string]string{
+	"htmlescaper":                            `{{.}}`,
+	"attrescaper":                            `<p title="{{.}}">`,
+	"nospaceescaper":                         `<p title={{.}}>`,
+	"rcdataescaper":                          `<title>{{.}}</title>`,
+	"htmlnamefilter":                         `<p {{.}}="">`,
+	"urlfilter,urlnormalizer,attrescaper":    `<a href="{{.}}">`,
+	"urlnormalizer,attrescaper":              `<a href="/{{.}}">`,
+	"urlescaper,attrescaper":                 `<a href="/?{{.}}">`,
+	"urlfilter,urlnormalizer,nospaceescaper": `<a href={{.}}>`,
+	"urlnormalizer,nospaceescaper":           `<a href=/{{.}}>`,
+	"urlescaper,nospaceescaper":              `<a href=/?{{.}}>`,
+	"srcsetescaper,attrescaper":              `<img srcset="{{.}}">`,
+	"srcsetescaper,nospaceescaper":           `<img srcset={{.}}>`,
+	"jsvalescaper":                           `<script>x = {{.}}</script>`,
+	"jsstrescaper":                           `<script>x = "{{.}}"</script>`,
+	"jsregexpescaper":                        `<script>x = /{{.}}/</script>`,
+	"jstmpllitescaper":                       "<script>x = `{{.}}`</script>",
+	"jsvalescaper,attrescaper":               `<p onclick="x = {{.}}">`,
+	"jsvalescaper,nospaceescaper":            `<p onclick={{.}}>`,
+	"jsregexpescaper,nospaceescaper":         `<p onclick=/{{.}}/>`,
+	"cssvaluefilter":                         `<style>p { color: {{.}} }</style>`,
+	"urlfilter,cssescaper":                   `<style>p { font-family: "{{.}}" }</style>`,
+	"urlfilter,urlnormalizer":                `<style>p { background: url({{.}}) }</style>`,
+	"urlnormalizer":                          `<style>p { background: url(/{{.}}) }</style>`,
+	"urlescaper":                             `<style>p { background: url(/?{{.}}) }</style>`,
+	"cssvaluefilter,attrescaper":             `<p style="color: {{.}}">`,
+	"cssvaluefilter,nospaceescaper":          `<p style=color:{{.}}>`,
+	"commentescaper":                         `<!-- {{.}} -->`,
+}
+
+var escaperFuncs = map[string]func(...interface{}) string{
+	"attrescaper":      AttrEscaper,
+	"commentescaper":   CommentEscaper,
+	"cssescaper":       CSSEscaper,
+	"cssvaluefilter":   CSSValueFilter,
+	"htmlnamefilter":   HTMLNameFilter,
+	"htmlescaper":      HTMLEscaper,
+	"jsregexpescaper":  JSRegexpEscaper,
+	"jsstrescaper":     JSStrEscaper,
+	"jstmpllitescaper": JSTmplLitEscaper,
+	"jsvalescaper":     JSValEscaper,
+	"nospaceescaper":   NospaceEscaper,
+	"rcdataescaper":    RCDATAEscaper,
+	"srcsetescaper":    SrcsetEscaper,
+	"urlescaper":       URLEscaper,
+	"urlfilter":        URLFilter,
+	"urlnormalizer":    URLNormalizer,
+}
+
+type stringer struct{}
+
+func (stringer) String() string { return `<"s" & 's'>` }
+
+var probeValues = []interface{}{
+	nil,
+	"",
+	"plain",
+	`<a href="x">'&'</a> + "q" \ /`,
+	"javascript:alert(1)",
+	"http://example.com/a b?c=d&e=f#g",
+	"a.png 1x, b.png 2x, javascript:x 3x",
+	"red; background: url(x)",
+	"expression(x)",
+	"</script><!-- `${x}` */   \x00",
+	"title",
+	"onclick",
+	1.5,
+	-2,
+	true,
+	[]int{1, 2},
+	map[string]string{"a": "<b>"},
+	struct{ A string }{"</script>"},
+	&struct{ B *int }{},
+	stringer{},
+	errors.New("<err>"),
+	template.HTML(`<b title="1>2">bold</b> <!-- c --> I <3 <script>if (a < b) {}</script> & more`),
+	template.HTML(`<p>unterminated <a href="x`),
+	template.HTML(`<TEXTAREA>a <b> c</textarea>d<title>e</title`),
+	template.HTML(`<style>p > a {}</STYLE>f<script>g`),
+	template.HTML(`x<!-- y`),
+	template.HTML(`<a title='1>2' href=a>b</a> c < d </> <1`),
+	template.HTMLAttr(`title="x"`),
+	template.URL("javascript:ok()"),
+	template.JS(`f("x")`),
+	template.JSStr(`a\"b`),
+	template.CSS("color: red"),
+	template.Srcset("a.png 1x"),
+}
+
+// hostileValues are strings written to break out of the context of an action or to smuggle
+// in a scheme, tag, comment or expression the escapers must neutralize.
+var hostileValues = []interface{}{
+	`"><script>alert(1)</script>`,
+	`' onmouseover='alert(1)`,
+	"` onload=alert(1) x=`",
+	"</ScRiPt ><script>alert(1)</script>",
+	"</style ><script>alert(1)</script>",
+	"<!--<script>",
+	"--><img src=x onerror=alert(1)>",
+	"<![CDATA[x]]>",
+	"JaVaScRiPt:alert(1)",
+	" javascript:alert(1)",
+	"java\tscript:alert(1)",
+	"java\nscript:alert(1)",
+	"vbscript:msgbox(1)",
+	"data:text/html,<script>alert(1)</script>",
+	"//evil.example/%2e%2e/?a=b&c=<d>#'e'",
+	"/a%zz%2F%ff?b=c d",
+	"http://a/b c.png 1x,javascript:alert(1) 2x, d.png",
+	",,  ,x.png 100w",
+	"\\u0065xpression(alert(1))",
+	"e\\78 pression(alert(1))",
+	"url(javascript:alert(1))",
+	"red;}body{background:url(x)}",
+	"@import 'x';",
+	"/* */ color: red",
+	"\\0 \\a \\\\ \\\"",
+	"-moz-binding:url(x)",
+	`\u003cscript\u003e`,
+	"\u2028\u2029\ufeff\x00\x7f",
+	"\r\n\t\f\v",
+	"${alert(1)}`",
+	"/x/;alert(1)//",
+	"[a-z]+\\/(?:x)",
+	"&lt;&amp;&#39;&#x3c;&quot",
+	"\xff\xfe invalid \xc3",
+	"ünïcödé 日本 🙂",
+	"=x",
+	"a b=c",
+	"xmlns:on",
+	"style",
+	"srcset",
+}
+
+// Test_escapers checks the escapers are those html/template adds for each probe, and that
+// they escape values, hostile ones among them, as html/template does.
+func Test_escapers(t *testing.T) {
+	probed := make(map[string]bool)
+	for chain := range probes {
+		for _, name := range strings.Split(chain, ",") {
+			probed[name] = true
+		}
+	}
+	for name := range escaperFuncs {
+		if !probed[name] {
+			t.Errorf("no probe escapes with %s", name)
+		}
+	}
+	for chain, src := range probes {
+		tmpl := template.Must(template.New(chain).Parse(src))
+		if err := tmpl.Execute(io.Discard, ""); err != nil {
+			t.Fatal(chain, err)
+		}
+		var escapers []string
+		for _, n := range tmpl.Tree.Root.Nodes {
+			a, ok := n.(*parse.ActionNode)
+			if !ok {
+				continue
+			}
+			for _, cmd := range a.Pipe.Cmds {
+				if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && strings.HasPrefix(id.Ident, "_html_template_") {
+					escapers = append(escapers, strings.TrimPrefix(id.Ident, "_html_template_"))
+				}
+			}
+		}
+		if chain == "commentescaper" {
+			// html/template removes comments along with their actions
+			escapers = []string{"commentescaper"}
+		} else if r := strings.Join(escapers, ","); r != chain {
+			t.Fatalf("probe %q escaped with %s, expected %s", src, r, chain)
+		}
+
+		i := strings.Index(src, "{{.}}")
+		prefix, suffix := src[:i], src[i+len("{{.}}"):]
+		for _, v := range append(probeValues, hostileValues...) {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, v); err != nil {
+				t.Fatal(chain, err)
+			}
+			expect := b.String()
+			if chain != "commentescaper" {
+				expect = strings.TrimSuffix(strings.TrimPrefix(expect, prefix), suffix)
+			}
+			r := Interface(reflect.ValueOf(v))
+			for _, name := range escapers {
+				r = escaperFuncs[name](r)
+			}
+			if r != expect {
+				t.Errorf("%s escaped %#v as %q, expected %q", chain, v, r, expect)
+			}
+		}
+	}
+}
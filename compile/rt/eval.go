@@ -0,0 +1,462 @@
+// Parts of this file are copied or adapted from Go's text/template package:
+//
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rt
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	errorType        = reflect.TypeFor[error]()
+	fmtStringerType  = reflect.TypeFor[fmt.Stringer]()
+	reflectValueType = reflect.TypeFor[reflect.Value]()
+)
+
+// Arg is an argument of a function or method call. Constant arguments take the type
+// of the parameter they're given to.
+type Arg interface {
+	arg(s *State, typ reflect.Type) reflect.Value
+}
+
+type value reflect.Value
+
+// Val returns an argument with the evaluated value v.
+func Val(v reflect.Value) Arg {
+	return value(v)
+}
+
+func (v value) arg(s *State, typ reflect.Type) reflect.Value {
+	return s.validateType(reflect.Value(v), typ)
+}
+
+// Lazy returns an argument evaluated by fn when it's needed, as are the arguments of
+// and and or.
+type Lazy func() reflect.Value
+
+func (fn Lazy) arg(s *State, typ reflect.Type) reflect.Value {
+	return s.validateType(fn(), typ)
+}
+
+// Nil is the constant nil.
+type Nil struct{}
+
+func (Nil) arg(s *State, typ reflect.Type) reflect.Value {
+	if canBeNil(typ) {
+		return reflect.Zero(typ)
+	}
+	s.errorf("cannot assign nil to %s", typ)
+	panic(errNotReached)
+}
+
+// Bool is a constant true or false.
+type Bool bool
+
+func (b Bool) arg(s *State, typ reflect.Type) reflect.Value {
+	switch typ.Kind() {
+	case reflect.Bool:
+		v := reflect.New(typ).Elem()
+		v.SetBool(bool(b))
+		return v
+	case reflect.Interface, reflect.Struct:
+		return s.constant(typ, reflect.ValueOf(bool(b)), b)
+	}
+	s.errorf("expected %s; found %v", kindName(typ), b)
+	panic(errNotReached)
+}
+
+// String is a constant string.
+type String string
+
+func (str String) arg(s *State, typ reflect.Type) reflect.Value {
+	switch typ.Kind() {
+	case reflect.String:
+		v := reflect.New(typ).Elem()
+		v.SetString(string(str))
+		return v
+	case reflect.Interface, reflect.Struct:
+		return s.constant(typ, reflect.ValueOf(string(str)), str)
+	}
+	s.errorf("expected %s; found %q", kindName(typ), string(str))
+	panic(errNotReached)
+}
+
+// Number is a numeric constant, with each representation of its value that is exact.
+type Number struct {
+	Text      string
+	IsInt     bool
+	IsUint    bool
+	IsFloat   bool
+	IsComplex bool
+	Int       int64
+	Uint      uint64
+	Float     float64
+	Complex   complex128
+}
+
+func (n Number) arg(s *State, typ reflect.Type) reflect.Value {
+	v := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n.IsInt {
+			v.SetInt(n.Int)
+			return v
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n.IsUint {
+			v.SetUint(n.Uint)
+			return v
+		}
+	case reflect.Float32, reflect.Float64:
+		if n.IsFloat {
+			v.SetFloat(n.Float)
+			return v
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if n.IsComplex {
+			v.SetComplex(n.Complex)
+			return v
+		}
+	case reflect.Interface, reflect.Struct:
+		return s.constant(typ, n.Value(s), n)
+	}
+	s.errorf("expected %s; found %s", kindName(typ), n.Text)
+	panic(errNotReached)
+}
+
+// Value returns the value of the number where its type isn't known, following the rules
+// of Go for untyped constants.
+func (n Number) Value(s *State) reflect.Value {
+	switch {
+	case n.IsComplex:
+		return reflect.ValueOf(n.Complex)
+	case n.IsFloat && !isHexInt(n.Text) && !isRuneInt(n.Text) && containsAny(n.Text, ".eEpP"):
+		return reflect.ValueOf(n.Float)
+	case n.IsInt:
+		i := int(n.Int)
+		if int64(i) != n.Int {
+			s.errorf("%s overflows int", n.Text)
+		}
+		return reflect.ValueOf(i)
+	case n.IsUint:
+		s.errorf("%s overflows int", n.Text)
+	}
+	return reflect.Value{}
+}
+
+func isRuneInt(s string) bool {
+	return len(s) > 0 && s[0] == '\''
+}
+
+func isHexInt(s string) bool {
+	return len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && !containsAny(s, "pP")
+}
+
+func containsAny(s, chars string) bool {
+	for i := 0; i < len(s); i++ {
+		for j := 0; j < len(chars); j++ {
+			if s[i] == chars[j] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// constant returns v, the value of constant c, for a parameter of interface type or
+// reflect.Value.
+func (s *State) constant(typ reflect.Type, v reflect.Value, c interface{}) reflect.Value {
+	switch {
+	case typ.Kind() == reflect.Interface && typ.NumMethod() == 0:
+		return v
+	case typ == reflectValueType:
+		return reflect.ValueOf(v)
+	}
+	s.errorf("can't handle %v for arg of type %s", c, typ)
+	panic(errNotReached)
+}
+
+func kindName(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "unsigned integer"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Complex64, reflect.Complex128:
+		return "complex"
+	}
+	return typ.String()
+}
+
+// Field evaluates the chain of fields, methods and map keys given by idents on receiver,
+// as in .X.Y.Z, calling the last with args and final if it's a method.
+func (s *State) Field(receiver reflect.Value, idents []string, final reflect.Value, args ...Arg) reflect.Value {
+	n := len(idents)
+	for i := 0; i < n-1; i++ {
+		receiver = s.field(idents[i], nil, Missing, receiver)
+	}
+	// Now if it's a method, it gets the arguments.
+	return s.field(idents[n-1], args, final, receiver)
+}
+
+// field evaluates an expression like (.Field) or (.Field arg1 arg2). The final argument
+// represents the return value from the preceding value of the pipeline, if any.
+func (s *State) field(fieldName string, args []Arg, final, receiver reflect.Value) reflect.Value {
+	if !receiver.IsValid() {
+		return reflect.Value{}
+	}
+	typ := receiver.Type()
+	receiver, isNil := indirect(receiver)
+	if receiver.Kind() == reflect.Interface && isNil {
+		// Calling a method on a nil interface can't work. The MethodByName method
+		// call below would panic.
+		s.errorf("nil pointer evaluating %s.%s", typ, fieldName)
+	}
+
+	// Unless it's an interface, need to get to a value of type *T to guarantee we see
+	// all methods of T and *T.
+	ptr := receiver
+	if ptr.Kind() != reflect.Interface && ptr.Kind() != reflect.Pointer && ptr.CanAddr() {
+		ptr = ptr.Addr()
+	}
+	if method := ptr.MethodByName(fieldName); method.IsValid() {
+		return s.call(method, false, fieldName, "", args, final)
+	}
+	hasArgs := len(args) > 0 || !isMissing(final)
+	// It's not a method; must be a field of a struct or an element of a map.
+	switch receiver.Kind() {
+	case reflect.Struct:
+		tField, ok := receiver.Type().FieldByName(fieldName)
+		if ok {
+			field, err := receiver.FieldByIndexErr(tField.Index)
+			if !tField.IsExported() {
+				s.errorf("%s is an unexported field of struct type %s", fieldName, typ)
+			}
+			if err != nil {
+				s.errorf("%v", err)
+			}
+			// If it's a function, we must call it.
+			if hasArgs {
+				s.errorf("%s has arguments but cannot be invoked as function", fieldName)
+			}
+			return field
+		}
+	case reflect.Map:
+		// If it's a map, attempt to use the field name as a key.
+		nameVal := reflect.ValueOf(fieldName)
+		if nameVal.Type().AssignableTo(receiver.Type().Key()) {
+			if hasArgs {
+				s.errorf("%s is not a method but has arguments", fieldName)
+			}
+			return receiver.MapIndex(nameVal)
+		}
+	case reflect.Pointer:
+		etyp := receiver.Type().Elem()
+		if etyp.Kind() == reflect.Struct {
+			if _, ok := etyp.FieldByName(fieldName); !ok {
+				// If there's no such field, say "can't evaluate" instead of "nil
+				// pointer evaluating".
+				break
+			}
+		}
+		if isNil {
+			s.errorf("nil pointer evaluating %s.%s", typ, fieldName)
+		}
+	}
+	s.errorf("can't evaluate field %s in type %s", fieldName, typ)
+	panic(errNotReached)
+}
+
+// Call calls the named function with args and final.
+func (s *State) Call(name string, final reflect.Value, args ...Arg) reflect.Value {
+	fn, isBuiltin, ok := findFunction(name)
+	if !ok {
+		s.errorf("%q is not a defined function", name)
+	}
+	return s.call(fn, isBuiltin, name, "", args, final)
+}
+
+// CallFunc calls the builtin call, where callee is the source of its first argument,
+// the function called.
+func (s *State) CallFunc(callee string, final reflect.Value, args ...Arg) reflect.Value {
+	fn, isBuiltin, _ := findFunction("call")
+	return s.call(fn, isBuiltin, "call", callee, args, final)
+}
+
+// call executes a function or method call. If it's a method, fun already has the
+// receiver bound, so it looks just like a function call.
+func (s *State) call(fun reflect.Value, isBuiltin bool, name, callee string, args []Arg, final reflect.Value) reflect.Value {
+	typ := fun.Type()
+	numIn := len(args)
+	if !isMissing(final) {
+		numIn++
+	}
+	numFixed := len(args)
+	if typ.IsVariadic() {
+		numFixed = typ.NumIn() - 1 // last arg is the variadic one.
+		if numIn < numFixed {
+			s.errorf("wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1, len(args))
+		}
+	} else if numIn != typ.NumIn() {
+		s.errorf("wrong number of args for %s: want %d got %d", name, typ.NumIn(), numIn)
+	}
+	if err := goodFunc(name, typ); err != nil {
+		s.errorf("%v", err)
+	}
+
+	unwrap := func(v reflect.Value) reflect.Value {
+		if v.Type() == reflectValueType {
+			v = v.Interface().(reflect.Value)
+		}
+		return v
+	}
+
+	// Special case for builtin and/or, which short-circuit.
+	if isBuiltin && (name == "and" || name == "or") {
+		argType := typ.In(0)
+		var v reflect.Value
+		for _, arg := range args {
+			v = arg.arg(s, argType).Interface().(reflect.Value)
+			if truth(v) == (name == "or") {
+				return v
+			}
+		}
+		if !isMissing(final) {
+			v = unwrap(s.validateType(final, argType))
+		}
+		return v
+	}
+
+	// Build the arg list.
+	argv := make([]reflect.Value, numIn)
+	// Args must be evaluated. Fixed args first.
+	i := 0
+	for ; i < numFixed && i < len(args); i++ {
+		argv[i] = args[i].arg(s, typ.In(i))
+	}
+	// Now the ... args.
+	if typ.IsVariadic() {
+		argType := typ.In(typ.NumIn() - 1).Elem() // Argument is a slice.
+		for ; i < len(args); i++ {
+			argv[i] = args[i].arg(s, argType)
+		}
+	}
+	// Add final value if necessary.
+	if !isMissing(final) {
+		t := typ.In(typ.NumIn() - 1)
+		if typ.IsVariadic() {
+			if numIn-1 < numFixed {
+				// The added final argument corresponds to a fixed parameter of the
+				// function. Validate against the type of the actual parameter.
+				t = typ.In(numIn - 1)
+			} else {
+				// The added final argument corresponds to the variadic part.
+				// Validate against the type of the elements of the variadic slice.
+				t = t.Elem()
+			}
+		}
+		argv[i] = s.validateType(final, t)
+	}
+
+	// Special case for the "call" builtin. Insert the name of the callee function as
+	// the first argument.
+	if isBuiltin && name == "call" {
+		if len(args) == 0 {
+			// final must be present or we would have errored out above.
+			callee = final.String()
+		}
+		argv = append([]reflect.Value{reflect.ValueOf(callee)}, argv...)
+		fun = reflect.ValueOf(call)
+	}
+
+	v, err := safeCall(fun, argv)
+	if err != nil {
+		s.errorf("error calling %s: %w", name, err)
+	}
+	return unwrap(v)
+}
+
+// canBeNil reports whether an untyped nil can be assigned to the type. See reflect.Zero.
+func canBeNil(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Pointer, reflect.Slice:
+		return true
+	case reflect.Struct:
+		return typ == reflectValueType
+	}
+	return false
+}
+
+// validateType guarantees that the value is valid and assignable to the type.
+func (s *State) validateType(value reflect.Value, typ reflect.Type) reflect.Value {
+	if !value.IsValid() {
+		if typ == nil {
+			// An untyped nil interface{}. Accept as a proper nil value.
+			return reflect.ValueOf(nil)
+		}
+		if canBeNil(typ) {
+			// Like above, but use the zero value of the non-nil type.
+			return reflect.Zero(typ)
+		}
+		s.errorf("invalid value; expected %s", typ)
+	}
+	if typ == reflectValueType && value.Type() != typ {
+		return reflect.ValueOf(value)
+	}
+	if typ != nil && !value.Type().AssignableTo(typ) {
+		if value.Kind() == reflect.Interface && !value.IsNil() {
+			value = value.Elem()
+			if value.Type().AssignableTo(typ) {
+				return value
+			}
+			// fallthrough
+		}
+		// Does one dereference or indirection work?
+		switch {
+		case value.Kind() == reflect.Pointer && value.Type().Elem().AssignableTo(typ):
+			value = value.Elem()
+			if !value.IsValid() {
+				s.errorf("dereference of nil pointer of type %s", typ)
+			}
+		case reflect.PointerTo(value.Type()).AssignableTo(typ) && value.CanAddr():
+			value = value.Addr()
+		default:
+			s.errorf("wrong type for value; expected %s; got %s", typ, value.Type())
+		}
+	}
+	return value
+}
+
+// indirect returns the item at the end of indirection, and a bool to indicate if it's
+// nil. If the returned bool is true, the returned value's kind will be either a pointer
+// or interface.
+func indirect(v reflect.Value) (rv reflect.Value, isNil bool) {
+	for ; v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface; v = v.Elem() {
+		if v.IsNil() {
+			return v, true
+		}
+	}
+	return v, false
+}
+
+// indirectInterface returns the concrete value in an interface value, or else the zero
+// reflect.Value.
+func indirectInterface(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Interface {
+		return v
+	}
+	if v.IsNil() {
+		return reflect.Value{}
+	}
+	return v.Elem()
+}
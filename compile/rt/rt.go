@@ -0,0 +1,339 @@
+// Parts of this file are copied or adapted from Go's text/template package:
+//
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rt is the runtime of Go code generated by package compile. It evaluates the
+// fields, variables and function calls of template actions with the semantics of
+// text/template, and escapes their values as html/template would, so generated code
+// renders the same document as executing the template.
+//
+// The functions of this package are meant to be called by generated code only. The package
+// requires Go 1.23 or later for the iter package.
+package rt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"runtime"
+)
+
+// maxExecDepth limits the nesting of template calls, as in text/template.
+var maxExecDepth = initMaxExecDepth()
+
+func initMaxExecDepth() int {
+	if runtime.GOARCH == "wasm" {
+		return 1000
+	}
+	return 100000
+}
+
+// Missing is the final argument of a call that isn't preceded by a command of its
+// pipeline.
+var Missing = reflect.ValueOf(missingVal{})
+
+type missingVal struct{}
+
+func isMissing(v reflect.Value) bool {
+	return v.IsValid() && v.Type() == Missing.Type()
+}
+
+// ExecError is returned by Execute when a template fails to evaluate an action.
+type ExecError struct {
+	Name string // name of the template
+	Err  error
+}
+
+func (e ExecError) Error() string {
+	return "template: " + e.Name + ": " + e.Err.Error()
+}
+
+func (e ExecError) Unwrap() error {
+	return e.Err
+}
+
+// writeError wraps errors of the writer so they're returned as is.
+type writeError struct {
+	err error
+}
+
+// State is the state of a single execution of a generated template.
+type State struct {
+	w     io.Writer
+	name  string
+	depth int
+}
+
+// Execute calls fn with data as dot to write the document of the named template to w.
+// Errors evaluating the template are returned as an ExecError.
+func Execute(w io.Writer, name string, data interface{}, fn func(*State, reflect.Value)) (err error) {
+	s := &State{w: w, name: name}
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case ExecError:
+				err = e
+			case writeError:
+				err = e.err
+			default:
+				panic(r)
+			}
+		}
+	}()
+	v, ok := data.(reflect.Value)
+	if !ok {
+		v = reflect.ValueOf(data)
+	}
+	fn(s, v)
+	return nil
+}
+
+// Error stops execution with the given error message.
+func (s *State) Error(format string, args ...interface{}) reflect.Value {
+	panic(ExecError{Name: s.name, Err: fmt.Errorf(format, args...)})
+}
+
+func (s *State) errorf(format string, args ...interface{}) {
+	s.Error(format, args...)
+}
+
+// Write writes static text of the template.
+func (s *State) Write(b []byte) {
+	if _, err := s.w.Write(b); err != nil {
+		panic(writeError{err})
+	}
+}
+
+// WriteString writes the result of an escaped action.
+func (s *State) WriteString(str string) {
+	if _, err := io.WriteString(s.w, str); err != nil {
+		panic(writeError{err})
+	}
+}
+
+// Print writes the value of an action that isn't escaped.
+func (s *State) Print(v reflect.Value) {
+	iface, ok := printableValue(v)
+	if !ok {
+		s.errorf("can't print value of type %s", v.Type())
+	}
+	if _, err := fmt.Fprint(s.w, iface); err != nil {
+		panic(writeError{err})
+	}
+}
+
+// Template calls fn, the code of another template, with dot.
+func (s *State) Template(fn func(*State, reflect.Value), dot reflect.Value) {
+	if s.depth == maxExecDepth {
+		s.errorf("exceeded maximum template depth (%v)", maxExecDepth)
+	}
+	s.depth++
+	fn(s, dot)
+	s.depth--
+}
+
+// True reports whether v, the value of an if or with pipeline, is true.
+func (s *State) True(v reflect.Value) bool {
+	truth, ok := isTrue(indirectInterface(v))
+	if !ok {
+		s.errorf("if/with can't use %v", v)
+	}
+	return truth
+}
+
+// Dig returns the value held by v if it's an empty interface, as each command of a
+// pipeline does.
+func Dig(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Interface && v.Type().NumMethod() == 0 {
+		return v.Elem()
+	}
+	return v
+}
+
+// Iter iterates over the value of a range pipeline.
+type Iter struct {
+	val         reflect.Value
+	index, elem reflect.Value
+	i, n        int
+	keys        []reflect.Value
+	next        func() (reflect.Value, reflect.Value, bool)
+	stop        func()
+}
+
+// Range returns an iterator over v, the value of a range pipeline declaring nvars
+// variables.
+func (s *State) Range(v reflect.Value, nvars int) *Iter {
+	val, _ := indirect(v)
+	it := &Iter{val: val, i: -1}
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if nvars > 1 {
+			s.errorf("can't use %v to iterate over more than one variable", val)
+		}
+		it.pull(val.Seq(), nil)
+	case reflect.Array, reflect.Slice:
+		it.n = val.Len()
+	case reflect.Map:
+		it.keys = sortedKeys(val)
+		it.n = len(it.keys)
+	case reflect.Chan:
+		if val.IsNil() {
+			break
+		}
+		if val.Type().ChanDir() == reflect.SendDir {
+			s.errorf("range over send-only channel %v", val)
+		}
+		it.next = func() (reflect.Value, reflect.Value, bool) {
+			elem, ok := val.Recv()
+			return reflect.ValueOf(it.i), elem, ok
+		}
+	case reflect.Invalid:
+		// An invalid value is likely a nil map, etc. and acts like an empty map.
+	case reflect.Func:
+		switch {
+		case val.Type().CanSeq():
+			if nvars > 1 {
+				s.errorf("can't use %v iterate over more than one variable", val)
+			}
+			it.pull(val.Seq(), nil)
+		case val.Type().CanSeq2():
+			it.pull(nil, val.Seq2())
+			if nvars < 2 {
+				// a single variable is given the first value
+				next := it.next
+				it.next = func() (reflect.Value, reflect.Value, bool) {
+					k, _, ok := next()
+					return reflect.Value{}, k, ok
+				}
+			}
+		default:
+			s.errorf("range can't iterate over %v", val)
+		}
+	default:
+		s.errorf("range can't iterate over %v", val)
+	}
+	return it
+}
+
+// pull iterates with the values of seq or seq2.
+func (it *Iter) pull(seq iter.Seq[reflect.Value], seq2 iter.Seq2[reflect.Value, reflect.Value]) {
+	if seq2 == nil {
+		next, stop := iter.Pull(seq)
+		it.next = func() (reflect.Value, reflect.Value, bool) {
+			v, ok := next()
+			return reflect.Value{}, v, ok
+		}
+		it.stop = stop
+		return
+	}
+	next, stop := iter.Pull2(seq2)
+	it.next, it.stop = next, stop
+}
+
+// Next advances the iterator, reporting whether there's another element.
+func (it *Iter) Next() bool {
+	it.i++
+	if it.next != nil {
+		var ok bool
+		if it.index, it.elem, ok = it.next(); !ok {
+			it.Stop()
+			return false
+		}
+		it.n++
+		return true
+	}
+	if it.i >= it.n {
+		return false
+	}
+	if it.keys != nil {
+		it.index = it.keys[it.i]
+		it.elem = it.val.MapIndex(it.index)
+	} else {
+		it.index = reflect.ValueOf(it.i)
+		it.elem = it.val.Index(it.i)
+	}
+	return true
+}
+
+// Index returns the index or key of the current element.
+func (it *Iter) Index() reflect.Value {
+	return it.index
+}
+
+// Elem returns the current element.
+func (it *Iter) Elem() reflect.Value {
+	return it.elem
+}
+
+// Empty reports whether the iterator had no elements, such that the else branch of the
+// range is executed.
+func (it *Iter) Empty() bool {
+	return it.n == 0
+}
+
+// Stop ends the iteration, releasing the resources of iterator functions.
+func (it *Iter) Stop() {
+	if it.stop != nil {
+		it.stop()
+		it.stop = nil
+	}
+}
+
+// printableValue returns the, possibly indirected, interface value inside v that is best
+// for a call to a formatted printer.
+func printableValue(v reflect.Value) (interface{}, bool) {
+	if v.Kind() == reflect.Pointer {
+		v, _ = indirect(v) // fmt.Fprint handles nil.
+	}
+	if !v.IsValid() {
+		return "<no value>", true
+	}
+	if !v.Type().Implements(errorType) && !v.Type().Implements(fmtStringerType) {
+		if v.CanAddr() && (reflect.PointerTo(v.Type()).Implements(errorType) || reflect.PointerTo(v.Type()).Implements(fmtStringerType)) {
+			v = v.Addr()
+		} else {
+			switch v.Kind() {
+			case reflect.Chan, reflect.Func:
+				return nil, false
+			}
+		}
+	}
+	return v.Interface(), true
+}
+
+// isTrue reports whether the value is 'true', in the sense of not the zero of its type,
+// and whether the value has a meaningful truth value.
+func isTrue(val reflect.Value) (truth, ok bool) {
+	if !val.IsValid() {
+		// Something like var x interface{}, never set. It's a form of nil.
+		return false, true
+	}
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		truth = val.Len() > 0
+	case reflect.Bool:
+		truth = val.Bool()
+	case reflect.Complex64, reflect.Complex128:
+		truth = val.Complex() != 0
+	case reflect.Chan, reflect.Func, reflect.Pointer, reflect.UnsafePointer, reflect.Interface:
+		truth = !val.IsNil()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		truth = val.Int() != 0
+	case reflect.Float32, reflect.Float64:
+		truth = val.Float() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		truth = val.Uint() != 0
+	case reflect.Struct:
+		truth = true // Struct values are always true.
+	default:
+		return
+	}
+	return truth, true
+}
+
+var errNotReached = errors.New("not reached")
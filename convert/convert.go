@@ -0,0 +1,274 @@
+// Package convert converts html documents to damsel templates.
+//
+// Elements are written with the selector shorthand, #id.class, with %tag left out of
+// divs that have one, and an element whose only content is another element is written
+// on the same line, as in %html %body. Whitespace in text is collapsed as html renders
+// it, except in elements where it's significant, such as pre, whose text is escaped
+// with backticks so it's kept as is. Markup in html comments is converted along with
+// the rest of the document.
+//
+// Html is parsed as browsers parse it, by golang.org/x/net/html, which is vendored.
+// Elements the parser implies where a document leaves them out, such as head and body,
+// are left out of the template as well. The parser sorts the attributes of formatting
+// elements, such as a and b, which are written in its order.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"dasa.cc/damsel/parse"
+)
+
+// HTML returns the damsel template of the html document src, formatted as by
+// parse.Format.
+func HTML(src []byte) ([]byte, error) {
+	root, err := parseHTML(string(src))
+	if err != nil {
+		return nil, err
+	}
+	nodes := collapse(root.children, true)
+	c := &converter{}
+	for i, n := range nodes {
+		if n.typ == textNode {
+			return nil, fmt.Errorf("damsel: text outside of an element: %q", n.text)
+		}
+		if err := c.node(n, 0, normalText); err != nil {
+			return nil, err
+		}
+		if n.typ == doctypeNode && i+1 < len(nodes) {
+			c.lines = append(c.lines, &parse.Line{Kind: parse.BlankLine})
+		}
+	}
+	var buf bytes.Buffer
+	if err := parse.WriteLines(&buf, c.lines); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// textMode is how the text of an element is written.
+type textMode int
+
+const (
+	normalText textMode = iota // whitespace is collapsed
+	preText                    // whitespace is significant
+	rawText                    // whitespace is significant and the text isn't escaped
+)
+
+type converter struct {
+	lines []*parse.Line
+}
+
+func (c *converter) node(n *node, depth int, mode textMode) error {
+	switch n.typ {
+	case textNode:
+		for _, text := range textLines(n.text, mode) {
+			c.lines = append(c.lines, &parse.Line{Kind: parse.TextLine, Depth: depth, Text: text})
+		}
+	case doctypeNode:
+		c.lines = append(c.lines, &parse.Line{Kind: parse.ElemLine, Depth: depth, Elems: []*parse.LineElem{{Comment: true}}, Text: []byte(n.text)})
+	default:
+		return c.elem(n, depth, mode)
+	}
+	return nil
+}
+
+// elem adds the lines of n and its children. Elements whose only child is an element are
+// written on one line with it, and the first text of an element follows it.
+func (c *converter) elem(n *node, depth int, mode textMode) error {
+	chain := []*node{n}
+	for last := n; isChain(last); {
+		last = last.children[0]
+		chain = append(chain, last)
+	}
+	l := &parse.Line{Kind: parse.ElemLine, Depth: depth}
+	for _, el := range chain {
+		lel, err := lineElem(el)
+		if err != nil {
+			return err
+		}
+		l.Elems = append(l.Elems, lel)
+	}
+	c.lines = append(c.lines, l)
+
+	last := chain[len(chain)-1]
+	if tag := strings.ToLower(last.tag); rawElements[tag] {
+		mode = rawText
+	} else if preElements[tag] && mode == normalText {
+		mode = preText
+	}
+	// each inline element is nested one level deeper than the last, counted as half of a
+	// tab, so the children of the last are indented past all of them.
+	depth += (len(chain) + 1) / 2
+	children := last.children
+	if len(children) != 0 && children[0].typ == textNode {
+		texts := textLines(children[0].text, mode)
+		l.Text, l.Space = texts[0], true
+		for _, text := range texts[1:] {
+			c.lines = append(c.lines, &parse.Line{Kind: parse.TextLine, Depth: depth, Text: text})
+		}
+		children = children[1:]
+	}
+	for _, child := range children {
+		if err := c.node(child, depth, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isChain reports whether the only content of n is an element written on its line.
+func isChain(n *node) bool {
+	if len(n.children) != 1 || n.typ == elementNode && preElements[strings.ToLower(n.tag)] {
+		return false
+	}
+	typ := n.children[0].typ
+	return typ == elementNode || typ == commentNode
+}
+
+// lineElem returns n as written in a line, its id and classes as selectors where they
+// can be written as one.
+func lineElem(n *node) (*parse.LineElem, error) {
+	if n.typ == commentNode {
+		el := &parse.LineElem{Comment: true}
+		if n.cond != "" {
+			el.Attrs = []parse.LineAttr{{Key: []byte(n.cond)}}
+		}
+		return el, nil
+	}
+	el := &parse.LineElem{}
+	for _, a := range n.attrs {
+		if strings.ContainsAny(a.key, "[]") {
+			return nil, fmt.Errorf("damsel: attribute %s of %s can not be written", a.key, n.tag)
+		}
+		switch {
+		case a.key == "id" && el.IDs == nil && parse.IsIdent(a.value):
+			el.IDs = [][]byte{[]byte(a.value)}
+			continue
+		case a.key == "class" && el.Classes == nil && a.value != "":
+			classes := strings.Fields(a.value)
+			ok := true
+			for _, class := range classes {
+				ok = ok && parse.IsIdent(class)
+			}
+			if ok {
+				for _, class := range classes {
+					el.Classes = append(el.Classes, []byte(class))
+				}
+				continue
+			}
+		}
+		el.Attrs = append(el.Attrs, parse.LineAttr{Key: []byte(a.key), Value: attrValue(a.value), HasValue: a.hasValue})
+	}
+	if !strings.EqualFold(n.tag, "div") || el.IDs == nil && el.Classes == nil {
+		el.Tag = []byte(n.tag)
+	}
+	return el, nil
+}
+
+// attrValue returns v escaped as an attribute value, with a leading quote escaped so
+// it's not taken to enclose the value.
+func attrValue(v string) []byte {
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c == '\\' || c == ']' || i == 0 && (c == '"' || c == '\'') {
+			b = append(b, '\\')
+		}
+		b = append(b, v[i])
+	}
+	return b
+}
+
+// textLines returns text as written in lines, which may be the lines of a single text
+// escaped with backticks.
+func textLines(text string, mode textMode) [][]byte {
+	switch mode {
+	case rawText:
+		// text escaped with backticks can't hold a backtick, which is written raw
+		// between the parts of the text escaped
+		var lines [][]byte
+		for i, part := range strings.Split(text, "`") {
+			if i != 0 {
+				lines = append(lines, []byte("!= `"))
+			}
+			if part != "" {
+				lines = append(lines, []byte("`"+part+"`"))
+			}
+		}
+		return lines
+	case preText:
+		if !strings.Contains(text, "`") {
+			return [][]byte{[]byte("`" + text + "`")}
+		}
+		return [][]byte{[]byte("!= " + escapeRaw(text))}
+	}
+	switch text[0] {
+	case '`':
+		return [][]byte{[]byte("!= " + escapeRaw(text))}
+	case '%', '#', '.', '!', '[', ':', '/', '\\', ' ':
+		text = "\\" + text
+	}
+	return [][]byte{[]byte(text)}
+}
+
+// escapeRaw returns text escaped as html to write on one line following !=, which
+// would otherwise drop leading whitespace.
+func escapeRaw(text string) string {
+	text = strings.ReplaceAll(html.EscapeString(text), "\n", "&#10;")
+	switch text[0] {
+	case ' ':
+		text = "&#32;" + text[1:]
+	case '\t':
+		text = "&#9;" + text[1:]
+	}
+	return text
+}
+
+// collapse returns nodes, the children of a block element if block, with the whitespace of
+// their text collapsed as it's rendered: each run of whitespace is a space, and space at
+// the start or end of a block element, or next to a block element, a comment or a doctype
+// is removed.
+func collapse(nodes []*node, block bool) []*node {
+	var r []*node
+	for i, n := range nodes {
+		if n.typ != textNode {
+			if n.typ == commentNode || !preElements[strings.ToLower(n.tag)] {
+				n.children = collapse(n.children, isBlock(n))
+			}
+			r = append(r, n)
+			continue
+		}
+		text := collapseSpace(n.text)
+		if i == 0 && block || i != 0 && isBlock(nodes[i-1]) {
+			text = strings.TrimPrefix(text, " ")
+		}
+		if i+1 == len(nodes) && block || i+1 < len(nodes) && isBlock(nodes[i+1]) {
+			text = strings.TrimSuffix(text, " ")
+		}
+		if text != "" {
+			n.text = text
+			r = append(r, n)
+		}
+	}
+	return r
+}
+
+// collapseSpace returns s with each run of whitespace replaced by a space.
+func collapseSpace(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if !isSpace(s[i]) {
+			b = append(b, s[i])
+		} else if len(b) == 0 || b[len(b)-1] != ' ' {
+			b = append(b, ' ')
+		}
+	}
+	return string(b)
+}
+
+func isBlock(n *node) bool {
+	return n.typ != elementNode || blockElements[strings.ToLower(n.tag)]
+}
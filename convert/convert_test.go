@@ -0,0 +1,181 @@
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dasa.cc/damsel"
+	"dasa.cc/damsel/parse"
+)
+
+func render(t *testing.T, src []byte) string {
+	tpl, err := damsel.ParseString(string(src))
+	if err != nil {
+		t.Fatalf("%s\n%v", src, err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Render(&buf); err != nil {
+		t.Fatalf("%s\n%v", src, err)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// Test_round_trip converts the html of the damsel test pairs and renders the result,
+// which must be the same html.
+func Test_round_trip(t *testing.T) {
+	files, err := filepath.Glob("../tests/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no html files")
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := HTML(b)
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if html := render(t, r); html != strings.TrimSpace(string(b)) {
+			t.Fatalf("%s: converted\n%s\nrendered %s", f, r, html)
+		}
+		if fr, err := parse.Format(r); err != nil || !bytes.Equal(fr, r) {
+			t.Fatalf("%s: not formatted\n%s\n%s %v", f, r, fr, err)
+		}
+	}
+}
+
+func Test_HTML(t *testing.T) {
+	tests := []struct {
+		src, expect, html string
+	}{
+		{
+			"<!doctype html>\n<html>\n  <body>\n    <div id=main class='a  b'><p>Hi</p></div>\n  </body>\n</html>\n",
+			"!DOCTYPE html\n\n%html %body #main.a.b %p Hi\n",
+			"<!DOCTYPE html>\n<html><body><div id=\"main\" class=\"a b\"><p>Hi</p></div></body></html>",
+		},
+		{
+			"<p>\n  Some <b>bold</b>\n  and <i>italic</i> text.\n</p>",
+			"%p Some \n\t%b bold\n\t\\ and \n\t%i italic\n\t\\ text.\n",
+			"<p>Some <b>bold</b> and <i>italic</i> text.</p>",
+		},
+		{
+			"<ul><li>one<li>two</ul><p>a<p>b<div>c</div>",
+			"%ul\n\t%li one\n\t%li two\n%p a\n%p b\n%div c\n",
+			"<ul><li>one</li><li>two</li></ul>",
+		},
+		{
+			"<input type=checkbox checked disabled=\"\"><img src=x.png alt='a &amp; b'>",
+			"%input[type=checkbox][checked][disabled]\n%img[src=x.png][alt=a & b]\n",
+			"<input type=\"checkbox\" checked disabled>",
+		},
+		{
+			`<a href="/x]y" title='"q"' data-p="a\b" class="a.b">link</a>`,
+			`%a[class=a.b][data-p=a\\b][href=/x\]y][title=\"q"] link` + "\n",
+			`<a class="a.b" data-p="a\b" href="/x]y" title="&#34;q&#34;">link</a>`,
+		},
+		{
+			"<pre>  one\n    two &lt;</pre>",
+			"%pre `  one\n    two <`\n",
+			"<pre>  one\n    two &lt;</pre>",
+		},
+		{
+			"<pre>a `b`\n c</pre>",
+			"%pre != a `b`&#10; c\n",
+			"<pre>a `b`&#10; c</pre>",
+		},
+		{
+			"<script>\nvar a = 1;\n</script><style>p { color: red }</style>",
+			"%script `\nvar a = 1;\n`\n%style `p { color: red }`\n",
+			"<script>\nvar a = 1;\n</script>",
+		},
+		{
+			"<script>if (a < b && c) {\n  f()\n}</script>",
+			"%script `if (a < b && c) {\n  f()\n}`\n",
+			"<script>if (a < b && c) {\n  f()\n}</script>",
+		},
+		{
+			"<script>\nvar s = `a\n  ${b}`;\n</script>",
+			"%script `\nvar s = `\n\t!= `\n\t`a\n  ${b}`\n\t!= `\n\t`;\n`\n",
+			"<script>\nvar s = `a\n  ${b}`;\n</script>",
+		},
+		{
+			"<p>#not an id</p><p>:not an action</p><p> <b>x</b></p><p>`tick</p>",
+			"%p \\#not an id\n%p \\:not an action\n%p %b x\n%p != `tick\n",
+			"<p>#not an id</p>",
+		},
+		{
+			"<div><!-- note --><!--[if lt IE 9]><script src=html5.js></script><![endif]--></div>",
+			"%div\n\t! note\n\t![if lt IE 9] %script[src=html5.js]\n",
+			"<div><!--note--><!--[if lt IE 9]><script src=\"html5.js\"></script><![endif]--></div>",
+		},
+		{
+			"<!-- a < b --><p>x</p>",
+			"! a < b\n%p x\n",
+			"<!--a < b-->",
+		},
+		{
+			"<svg viewBox=\"0 0 1 1\"><rect width=1 /><svg:circle/></svg>",
+			"%svg[viewBox=0 0 1 1]\n\t%rect[width=1]\n\t%svg:circle\n",
+			"<svg viewBox=\"0 0 1 1\"><rect width=\"1\"></rect><svg:circle></svg:circle></svg>",
+		},
+		{
+			"<p id=1x class='a 2b'>x</p><p id=-y class=_z>y</p>",
+			"%p[id=1x][class=a 2b] x\n%p#-y._z y\n",
+			"<p id=\"1x\" class=\"a 2b\">x</p>",
+		},
+		{
+			"<DIV Id=x>&copy; 1 &lt; 2</DIV>",
+			"#x © 1 < 2\n",
+			"<div id=\"x\">© 1 &lt; 2</div>",
+		},
+		{
+			"<title>t</title><table><tr><td>x</td></tr></table>",
+			"%title t\n%table %tr %td x\n",
+			"<title>t</title>",
+		},
+		{
+			"<p>a\n<!-- open",
+			"%p a\n\t! open\n",
+			"<p>a<!--open--></p>",
+		},
+		{
+			"<!-- <div> --><p>x</p>",
+			"! <div>\n%p x\n",
+			"<!--<div>-->",
+		},
+	}
+	for _, tt := range tests {
+		r, err := HTML([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.src, err)
+		}
+		if string(r) != tt.expect {
+			t.Fatalf("%q\nexpected %q\nreceived %q", tt.src, tt.expect, r)
+		}
+		if html := render(t, r); !strings.HasPrefix(html, tt.html) {
+			t.Fatalf("%q\nexpected %q\nrendered %q", tt.src, tt.html, html)
+		}
+	}
+}
+
+func Test_HTML_errors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"<p>a</p> trailing", "damsel: text outside of an element: \"trailing\""},
+		{"<div [hidden]=x>", "damsel: attribute [hidden] of div can not be written"},
+	}
+	for _, tt := range tests {
+		_, err := HTML([]byte(tt.src))
+		if err == nil || err.Error() != tt.err {
+			t.Fatalf("%q\nexpected error %q\nreceived %v", tt.src, tt.err, err)
+		}
+	}
+}
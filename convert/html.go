@@ -0,0 +1,195 @@
+package convert
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type nodeType int
+
+const (
+	textNode nodeType = iota
+	elementNode
+	commentNode
+	doctypeNode
+)
+
+// node is a node of an html document.
+type node struct {
+	typ      nodeType
+	tag      string
+	attrs    []attr
+	cond     string // of a conditional comment, such as if IE
+	text     string // of text, or the declaration of a doctype
+	children []*node
+}
+
+type attr struct {
+	key, value string
+	hasValue   bool
+}
+
+// parseHTML returns the root of the tree of src, parsed as browsers parse html. Elements
+// the parser implies that src leaves out, such as head and body, are left out in turn,
+// their children taking their place.
+func parseHTML(src string) (*node, error) {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	written, _ := scan(src)
+	return &node{children: children(doc, written)}, nil
+}
+
+// scan returns the names of the elements src writes a start tag of, and whether it ends
+// each element it starts.
+func scan(src string) (written map[string]bool, complete bool) {
+	written, complete = make(map[string]bool), true
+	var open []string
+	z := html.NewTokenizer(strings.NewReader(src))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return written, complete && len(open) == 0
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			written[string(name)] = true
+			if !voidElements[string(name)] {
+				open = append(open, string(name))
+			}
+		case html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			written[string(name)] = true
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if n := len(open); n != 0 && open[n-1] == string(name) {
+				open = open[:n-1]
+			} else {
+				complete = false
+			}
+		}
+	}
+}
+
+// children returns the nodes of the children of n, with those of the elements implied
+// by the parser that aren't written in place of them.
+func children(n *html.Node, written map[string]bool) []*node {
+	var nodes []*node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			nodes = appendNode(nodes, &node{typ: textNode, text: c.Data})
+		case html.CommentNode:
+			nodes = append(nodes, comment(c.Data))
+		case html.DoctypeNode:
+			nodes = append(nodes, &node{typ: doctypeNode, text: doctype(c)})
+		case html.ElementNode:
+			if impliedElements[c.Data] && !written[c.Data] && len(c.Attr) == 0 {
+				for _, child := range children(c, written) {
+					nodes = appendNode(nodes, child)
+				}
+				continue
+			}
+			el := &node{typ: elementNode, tag: c.Data, children: children(c, written)}
+			for _, a := range c.Attr {
+				key := a.Key
+				if a.Namespace != "" {
+					key = a.Namespace + ":" + key
+				}
+				el.attrs = append(el.attrs, attr{key: key, value: a.Val, hasValue: a.Val != ""})
+			}
+			nodes = append(nodes, el)
+		}
+	}
+	return nodes
+}
+
+// appendNode appends n to nodes, joining text to text preceding it.
+func appendNode(nodes []*node, n *node) []*node {
+	if last := len(nodes) - 1; n.typ == textNode && last != -1 && nodes[last].typ == textNode {
+		nodes[last].text += n.text
+		return nodes
+	}
+	return append(nodes, n)
+}
+
+// doctype returns the declaration of the doctype n, such as DOCTYPE html.
+func doctype(n *html.Node) string {
+	decl := "DOCTYPE " + n.Data
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "public":
+			decl += ` PUBLIC "` + a.Val + `"`
+		case "system":
+			if !strings.Contains(decl, "PUBLIC") {
+				decl += " SYSTEM"
+			}
+			decl += ` "` + a.Val + `"`
+		}
+	}
+	return decl
+}
+
+var condComment = regexp.MustCompile(`(?s)^\[(if [^\]=]*)\]>(.*)<!\[endif\]$`)
+
+// comment returns the comment node of the text between <!-- and -->. Markup commented
+// out is parsed, so it's converted along with the rest of the document, unless it's
+// incomplete.
+func comment(text string) *node {
+	n := &node{typ: commentNode}
+	if m := condComment.FindStringSubmatch(text); m != nil {
+		n.cond, text = m[1], m[2]
+	}
+	if strings.IndexByte(text, '<') != -1 {
+		if _, complete := scan(text); complete {
+			if root, err := parseHTML(text); err == nil && hasElement(root.children) {
+				n.children = root.children
+				return n
+			}
+		}
+	}
+	if text != "" {
+		n.children = []*node{{typ: textNode, text: text}}
+	}
+	return n
+}
+
+func hasElement(nodes []*node) bool {
+	for _, n := range nodes {
+		if n.typ == elementNode {
+			return true
+		}
+	}
+	return false
+}
+
+// impliedElements are those the parser adds where a document leaves them out.
+var impliedElements = set("html", "head", "body", "tbody")
+
+var voidElements = set("area", "base", "br", "col", "embed", "hr", "img", "input", "keygen", "link", "meta", "param", "source", "track", "wbr")
+
+// rawElements are those whose content is written as is, without escaping.
+var rawElements = set("script", "style")
+
+// preElements are those whose whitespace is significant.
+var preElements = set("pre", "textarea", "script", "style")
+
+// blockElements are those whitespace next to is insignificant.
+var blockElements = set("address", "article", "aside", "blockquote", "body", "dd", "details", "dialog", "div", "dl", "dt",
+	"fieldset", "figcaption", "figure", "footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "head", "header", "hr",
+	"html", "li", "link", "main", "meta", "nav", "ol", "option", "p", "pre", "script", "section", "style", "summary",
+	"table", "tbody", "td", "tfoot", "th", "thead", "title", "tr", "ul")
+
+func set(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	return m
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
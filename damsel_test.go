@@ -1,11 +1,18 @@
 package damsel
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"dasa.cc/damsel/parse"
 )
@@ -38,11 +45,32 @@ func test(t *testing.T, s string, data interface{}) {
 	r, err := execute(tpl, data)
 	r = strings.TrimSpace(r)
 	if r != html {
-		fmt.Println("\nExpected\n========\n", html, "\nReceived\n========\n", r, "\n\n")
+		fmt.Println("\nExpected\n========\n", html, "\nReceived\n========\n", r)
 		t.Fatal("parse failed:", s, "\n", err)
 	}
 }
 
+func testCompiled(t *testing.T, s string, data interface{}) {
+	TemplateDir = TestsDir
+	html := get_html(t, s)
+
+	tpl := New().Mode(Compile)
+	if err := tpl.ParseFile(s + ".dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tpl.compile(); err != nil {
+		t.Fatal("compile failed:", s, "\n", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.execute(&buf, data); err != nil {
+		t.Fatal("execute failed:", s, "\n", err)
+	}
+	if r := strings.TrimSpace(buf.String()); r != html {
+		fmt.Println("\nExpected\n========\n", html, "\nReceived\n========\n", r)
+		t.Fatal("compiled parse failed:", s)
+	}
+}
+
 func Test_html(t *testing.T) {
 	test(t, "html", nil)
 }
@@ -94,6 +122,496 @@ func Test_big_table(t *testing.T) {
 	test(t, "bigtable", table)
 }
 
+func Test_compile(t *testing.T) {
+	letters := []string{"a", "b", "c", "d"}
+	testCompiled(t, "html", nil)
+	testCompiled(t, "indent", nil)
+	testCompiled(t, "variable_indent", nil)
+	testCompiled(t, "inline", letters)
+	testCompiled(t, "multiline_text", nil)
+	testCompiled(t, "tabs", nil)
+	testCompiled(t, "tag_hashes", nil)
+	testCompiled(t, "extends", nil)
+	testCompiled(t, "extends_super", nil)
+	testCompiled(t, "bigtable", [2][10]int{})
+}
+
+func Test_compile_blocks(t *testing.T) {
+	tests := []struct {
+		src, expect string
+	}{
+		{
+			"%ul\n\t{if .}\n\t%li One\n\t{else}\n\t%li Two\n\t{end}\n\t%li Three",
+			"<ul>{if .}<li>One</li>{else}<li>Two</li>{end}<li>Three</li></ul>",
+		},
+		{
+			"%html %body\n\t%table\n\t{range .}\n\t\t%tr\n\t\t{range .}\n\t\t\t%td {.}\n\t\t{end}\n\t\t%p trailing\n\t{end}",
+			"<html><body><table>{range .}<tr>{range .}<td>{.}</td>{end}</tr><p>trailing</p>{end}</table></body></html>",
+		},
+		{
+			"%p\n\t{with .}\n\tHello, {.}\n\t{end}\n\t%a link",
+			"<p>{with .}Hello, {.}{end}<a>link</a></p>",
+		},
+	}
+	for _, tt := range tests {
+		r, err := parse.NewDocParser("").Delims("{", "}").Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, tt.expect, r)
+		}
+	}
+
+	// ul_range_header opens an element conditionally, which can only be interpreted
+	TemplateDir = TestsDir
+	tpl := New().Mode(Compile)
+	if err := tpl.ParseFile("ul_range_header.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tpl.compile(); err == nil {
+		t.Fatal("expected error compiling ul_range_header")
+	}
+	for _, src := range []string{"%ul\n\t{range .}\n\t%li", "%ul\n\t%li\n{end}", "%ul\n\t%li {if .}\n\t%li\n\t{end}"} {
+		if _, err := parse.NewDocParser("").Delims("{", "}").Parse([]byte(src)); err == nil {
+			t.Fatalf("%q: expected error", src)
+		}
+	}
+}
+
+func Test_raw(t *testing.T) {
+	tpl, err := ParseString("%div\n\t%p 1 < 2\n\t:raw\n\t\t<b>trusted</b>\n\t\t<i>html</i>\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tpl.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != "<div><p>1 &lt; 2</p><b>trusted</b><i>html</i></div>" {
+		t.Fatal("unexpected result:", r)
+	}
+}
+
+// Test_raw_text checks the text of script and style elements is written as is when
+// executed in either mode.
+func Test_raw_text(t *testing.T) {
+	src := "%html\n\t%head %style a > b & c\n\t%body\n\t\t%script if (a < b && c) go()\n\t\t%p a < b\n"
+	expect := `<html><head><style>a > b & c</style></head><body><script>if (a < b && c) go()</script><p>a &lt; b</p></body></html>`
+	tpl, err := ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := tpl.Result(); err != nil || r != expect {
+		t.Fatalf("render: expected %s\nreceived %s %v", expect, r, err)
+	}
+	tpl = New().Mode(Compile)
+	if err := tpl.ParseString(src); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expect {
+		t.Fatalf("compile: expected %s\nreceived %s", expect, buf.String())
+	}
+}
+
+func Test_execute(t *testing.T) {
+	for _, mode := range []Mode{Interpret, Compile} {
+		tpl := New().Mode(mode)
+		if err := tpl.ParseString("%html %body\n\t%ul\n\t\t{range .}\n\t\t%li {.}\n\t\t{end}\n"); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, []string{"a<", "b"}); err != nil {
+			t.Fatal(err)
+		}
+		if expect := `<html><body><ul><li>a&lt;</li><li>b</li></ul></body></html>`; buf.String() != expect {
+			t.Fatalf("mode %v: expected %s\nreceived %s", mode, expect, buf.String())
+		}
+	}
+}
+
+// Test_selector_actions checks template actions may be written in the tag, id and class of
+// an element, whose names are checked once executed.
+func Test_selector_actions(t *testing.T) {
+	tpl := New()
+	if err := tpl.ParseString("%html %body\n\t%ul\n\t\t{range .Items}\n\t\t%li#item-{.}.c-{.} x\n\t\t{end}\n\t%{.Tag}.{.Tag} y\n"); err != nil {
+		t.Fatal(err)
+	}
+	type data struct {
+		Tag   string
+		Items []string
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data{"p", []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<html><body><ul><li id="item-a" class="c-a">x</li><li id="item-b" class="c-b">x</li></ul><p class="p">y</p></body></html>`
+	if buf.String() != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, buf.String())
+	}
+	err := tpl.Execute(&buf, data{"1p", nil})
+	if err == nil || !strings.Contains(err.Error(), `invalid tag name "1p"`) {
+		t.Fatalf("expected invalid tag name error, received %v", err)
+	}
+}
+
+// Test_execute_error checks errors in the output of html/template are located in the
+// output rather than in the files of the template.
+func Test_execute_error(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.dmsl": {Data: []byte("%html\n\t%body\n\t\t:include list.dmsl\n")},
+		"list.dmsl": {Data: []byte("%ul\n\t{range .}\n\t%li\n\t\t%{.} x\n\t{end}\n")},
+	}
+	tpl := New().Loader(FSLoader(fsys))
+	if err := tpl.ParseFile("page.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	var e *parse.Error
+	err := tpl.Execute(io.Discard, []string{"b", "1p"})
+	if !errors.As(err, &e) || e.Name != "html/template output of page.dmsl" || e.Line != 9 || e.Snippet != "\t\t\t\t%1p x" {
+		t.Fatalf("expected error at html/template output of page.dmsl:9, got %v", err)
+	}
+}
+
+func Test_action_error(t *testing.T) {
+	TemplateDir = TestsDir
+	_, err := ParseString("%html\n\t%body\n\t\t:include missing.dmsl\n")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected missing file error, got", err)
+	}
+	var ae *parse.ActionError
+	if !errors.As(err, &ae) || ae.Value != "include" {
+		t.Fatal("expected include action error, got", err)
+	}
+	var pe *parse.Error
+	if !errors.As(err, &pe) || pe.Line != 3 || pe.Col != 3 {
+		t.Fatal("expected error at 3:3, got", err)
+	}
+}
+
+func Test_funcs(t *testing.T) {
+	tpl := New().Funcs(parse.FuncMap{
+		"upper": func(a *parse.Action) ([]byte, error) {
+			return append([]byte(a.Whitespace()+"%p "), strings.ToUpper(string(a.Args))...), nil
+		},
+		"css": func(a *parse.Action) ([]byte, error) {
+			return []byte(a.Whitespace() + "%style"), nil
+		},
+	})
+	if err := tpl.ParseString("%html\n\t%head\n\t\t:css /css/\n\t\t\tmain.css\n\t%body\n\t\t:upper hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tpl.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != "<html><head><style></style></head><body><p>HELLO</p></body></html>" {
+		t.Fatal("unexpected result:", r)
+	}
+	if _, ok := parse.DefaultFuncMap["upper"]; ok {
+		t.Fatal("Funcs modified parse.DefaultFuncMap")
+	}
+}
+
+func Test_loader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout/base.dmsl": {Data: []byte("%html %body\n\t#content\n\t\t:include /layout/nav.dmsl\n")},
+		"layout/nav.dmsl":  {Data: []byte("%nav Home")},
+		"index.dmsl":       {Data: []byte(":extends layout/base.dmsl\n\n#content[super]\n\t%p Hello\n")},
+	}
+	tpl := New().Loader(FSLoader(fsys))
+	if err := tpl.ParseFile("index.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tpl.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != `<html><body><div id="content"><nav>Home</nav><p>Hello</p></div></body></html>` {
+		t.Fatal("unexpected result:", r)
+	}
+}
+
+// Test_dir_loader checks the default loader reads file paths as the operating system does,
+// including absolute paths and those leaving TemplateDir.
+func Test_dir_loader(t *testing.T) {
+	defer func(dir string) { TemplateDir = dir }(TemplateDir)
+	html := get_html(t, "html")
+	abs, err := filepath.Abs(filepath.Join(TestsDir, "html.dmsl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir, name string
+	}{
+		{"", abs},
+		{"", filepath.Join(TestsDir, "html.dmsl")},
+		{filepath.Join(TestsDir, "missing"), "../html.dmsl"},
+	}
+	for _, tt := range tests {
+		TemplateDir = tt.dir
+		tpl, err := ParseFile(tt.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if r, err := execute(tpl, nil); err != nil || strings.TrimSpace(r) != html {
+			t.Fatalf("%s: unexpected result %q %v", tt.name, r, err)
+		}
+	}
+}
+
+func Test_extends_chain(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.dmsl":    {Data: []byte("%html %body\n\t#content\n\t\t%p base\n\t#foot base")},
+		"section.dmsl": {Data: []byte(":extends base.dmsl\n\n#content[super]\n\t%p section\n\t#side\n")},
+		"page.dmsl":    {Data: []byte(":extends section.dmsl\n\n#content[super]\n\t%p page\n#side[prepend]\n\t%nav\n#foot page")},
+		"a.dmsl":       {Data: []byte(":extends b.dmsl\n")},
+		"b.dmsl":       {Data: []byte("%html\n\t:include /c.dmsl\n")},
+		"c.dmsl":       {Data: []byte(":extends a.dmsl\n")},
+		"self.dmsl":    {Data: []byte(":extends self.dmsl\n")},
+	}
+	tpl := New().Loader(FSLoader(fsys))
+	if err := tpl.ParseFile("page.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tpl.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `<html><body><div id="content"><p>base</p><p>section</p><div id="side"><nav></nav></div><p>page</p></div><div id="foot">page</div></body></html>`; r != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, r)
+	}
+
+	for name, cycle := range map[string]string{
+		"a.dmsl":    "a.dmsl -> b.dmsl -> c.dmsl -> a.dmsl",
+		"self.dmsl": "self.dmsl -> self.dmsl",
+	} {
+		err := New().Loader(FSLoader(fsys)).ParseFile(name)
+		if err == nil || !strings.Contains(err.Error(), "cycle in files "+cycle) {
+			t.Fatalf("%s: expected cycle error, got %v", name, err)
+		}
+	}
+}
+
+func Test_files(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.dmsl":    {Data: []byte("%html %body\n\t:include nav.dmsl\n\t#content")},
+		"nav.dmsl":     {Data: []byte("%ul\n\t:include /item.dmsl\n\t:include item.dmsl")},
+		"item.dmsl":    {Data: []byte("%li")},
+		"page.dmsl":    {Data: []byte(":extends base.dmsl\n\n#content %p page")},
+		"missing.dmsl": {Data: []byte(":extends base.dmsl\n\n#content\n\t:include none.dmsl")},
+	}
+	tests := []struct {
+		name   string
+		expect []string
+		err    bool
+	}{
+		{"page.dmsl", []string{"page.dmsl", "base.dmsl", "nav.dmsl", "item.dmsl"}, false},
+		{"missing.dmsl", []string{"missing.dmsl", "base.dmsl", "nav.dmsl", "item.dmsl", "none.dmsl"}, true},
+		{"none.dmsl", []string{"none.dmsl"}, true},
+	}
+	for _, tt := range tests {
+		tpl := New().Loader(FSLoader(fsys))
+		if err := tpl.ParseFile(tt.name); (err != nil) != tt.err {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if r := tpl.Files(); strings.Join(r, " ") != strings.Join(tt.expect, " ") {
+			t.Fatalf("%s: expected files %v, received %v", tt.name, tt.expect, r)
+		}
+	}
+}
+
+func Test_source_map(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.dmsl": {Data: []byte("%html\n\t%body\n\t\t:include nav.dmsl\n\t\t#content\n")},
+		"nav.dmsl":  {Data: []byte("%nav\n\t%a Home\n")},
+		"page.dmsl": {Data: []byte(":extends base.dmsl\n\n#content\n\t:js\n\t\ta.js\n\t%p Hello\n")},
+		"void.dmsl": {Data: []byte("%br\n\t%span\n")},
+		"bad.dmsl":  {Data: []byte("%html\n\t:include void.dmsl\n")},
+		"id.dmsl":   {Data: []byte("%html\n\t%body\n\t\t:include part.dmsl\n")},
+		"part.dmsl": {Data: []byte("%div\n\t:include a.dmsl\n")},
+		"a.dmsl":    {Data: []byte("%p\n\t%a#1x\n")},
+	}
+	tpl := New().Loader(FSLoader(fsys))
+	if err := tpl.ParseFile("page.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m, err := tpl.RenderMap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, mp := range m.Mappings {
+		got = append(got, fmt.Sprintf("%s@%s", mp.Origin, buf.String()[mp.Offset:mp.Offset+4]))
+	}
+	expect := "base.dmsl:1@<htm base.dmsl:2@<bod nav.dmsl:1@<nav nav.dmsl:2@<a>H base.dmsl:4@<div page.dmsl:4@<scr page.dmsl:6@<p>H"
+	if strings.Join(got, " ") != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, strings.Join(got, " "))
+	}
+
+	buf.Reset()
+	if err := tpl.DocMode(parse.SourceComments).Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<!-- nav.dmsl:2 --><a>Home</a>") {
+		t.Fatal("unexpected result:", buf.String())
+	}
+
+	tpl = New().Loader(FSLoader(fsys))
+	if err := tpl.ParseFile("bad.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	var e *parse.Error
+	if _, err := tpl.Result(); !errors.As(err, &e) || e.Name != "void.dmsl" || e.Line != 2 {
+		t.Fatalf("expected error at void.dmsl:2, got %v", err)
+	}
+
+	// errors in included lines are located in the lines as written
+	tpl = New().Loader(FSLoader(fsys))
+	if err := tpl.ParseFile("id.dmsl"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Result(); !errors.As(err, &e) || e.Name != "a.dmsl" || e.Line != 2 || e.Col != 5 || e.Snippet != "\t%a#1x" {
+		t.Fatalf("expected error at a.dmsl:2:5 in %q, got %v in %q", "\t%a#1x", err, e.Snippet)
+	}
+}
+
+func Test_set(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.dmsl":          {Data: []byte("%html %body\n\t#content\n\t:include partials/foot.dmsl\n")},
+		"partials/foot.dmsl": {Data: []byte("%footer {len .}")},
+		"list.dmsl":          {Data: []byte(":extends base.dmsl\n\n#content\n\t%ul\n\t\t{range .}\n\t\t%li {.}\n\t\t{end}\n")},
+	}
+	set, err := ParseSet(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Lookup("list.dmsl") == nil || set.Lookup("partials/foot.dmsl") == nil || set.Lookup("missing.dmsl") != nil {
+		t.Fatal("unexpected lookup result")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// reloading may be toggled while templates are executed
+			set.Reload(i%2 == 0)
+			var buf bytes.Buffer
+			data := []int{i, i + 1}
+			if err := set.ExecuteTemplate(&buf, "list.dmsl", data); err != nil {
+				t.Error(err)
+				return
+			}
+			expect := fmt.Sprintf(`<html><body><div id="content"><ul><li>%d</li><li>%d</li></ul></div><footer>2</footer></body></html>`, i, i+1)
+			if buf.String() != expect {
+				t.Error("unexpected result:", buf.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := set.ExecuteTemplate(ioutil.Discard, "missing.dmsl", nil); err == nil {
+		t.Fatal("expected error for missing template")
+	}
+}
+
+func Test_set_reload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.dmsl":  {Data: []byte("%html %body\n\t:include nav.dmsl\n\t#content")},
+		"nav.dmsl":   {Data: []byte("%nav one")},
+		"page.dmsl":  {Data: []byte(":extends base.dmsl\n\n#content %p {.}")},
+		"other.dmsl": {Data: []byte("%p other")},
+	}
+	set, err := ParseSet(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Reload(true)
+	execute := func(name, expect string) {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := set.ExecuteTemplate(&buf, name, "page"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expect {
+			t.Fatalf("expected %s\nreceived %s", expect, buf.String())
+		}
+	}
+
+	execute("page.dmsl", `<html><body><nav>one</nav><div id="content"><p>page</p></div></body></html>`)
+	page := set.Lookup("page.dmsl")
+	execute("page.dmsl", `<html><body><nav>one</nav><div id="content"><p>page</p></div></body></html>`)
+	if set.Lookup("page.dmsl") != page {
+		t.Fatal("template parsed again without a change")
+	}
+
+	// a transitively included file
+	fsys["nav.dmsl"] = &fstest.MapFile{Data: []byte("%nav two"), ModTime: time.Unix(1, 0)}
+	execute("page.dmsl", `<html><body><nav>two</nav><div id="content"><p>page</p></div></body></html>`)
+	if set.Lookup("other.dmsl") == nil {
+		t.Fatal("missing other.dmsl")
+	}
+
+	// an added template, and a change that fails to parse
+	fsys["new.dmsl"] = &fstest.MapFile{Data: []byte("%p new")}
+	execute("new.dmsl", `<p>new</p>`)
+	fsys["base.dmsl"] = &fstest.MapFile{Data: []byte("%html\n\t:nope"), ModTime: time.Unix(2, 0)}
+	if err := set.ExecuteTemplate(ioutil.Discard, "page.dmsl", nil); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+
+	// without reload, templates stay as parsed
+	set.Reload(false)
+	fsys["other.dmsl"] = &fstest.MapFile{Data: []byte("%p changed"), ModTime: time.Unix(3, 0)}
+	execute("other.dmsl", `<p>other</p>`)
+}
+
+// Test_format checks the templates of the tests directory render the same documents,
+// includes and extends evaluated, once formatted.
+func Test_format(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(TestsDir, "*.dmsl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, formatted := fstest.MapFS{}, fstest.MapFS{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := parse.Format(b)
+		if err != nil {
+			t.Fatal(f, err)
+		}
+		src[filepath.Base(f)] = &fstest.MapFile{Data: b}
+		formatted[filepath.Base(f)] = &fstest.MapFile{Data: r}
+	}
+	render := func(fsys fstest.MapFS, name string, mode Mode) (string, error) {
+		tpl := New().Loader(FSLoader(fsys)).Mode(mode)
+		if err := tpl.ParseFile(name); err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		err := tpl.Execute(&buf, nil)
+		return buf.String(), err
+	}
+	for name := range src {
+		for _, mode := range []Mode{Interpret, Compile} {
+			expect, err := render(src, name, mode)
+			r, ferr := render(formatted, name, mode)
+			if (err == nil) != (ferr == nil) || r != expect {
+				t.Fatalf("%s: formatted template differs\nexpected %s %v\nreceived %s %v", name, expect, err, r, ferr)
+			}
+		}
+	}
+}
+
 func Benchmark_parser(b *testing.B) {
 	b.StopTimer()
 	bytes, err := ioutil.ReadFile(filepath.Join(TestsDir, "bigtable2.dmsl"))
@@ -134,6 +652,23 @@ func Benchmark_bigtable(b *testing.B) {
 	}
 }
 
+func Benchmark_bigtable_compiled(b *testing.B) {
+	b.StopTimer()
+	TemplateDir = TestsDir
+	tpl := New().Mode(Compile)
+	if err := tpl.ParseFile("bigtable.dmsl"); err != nil {
+		b.Fatal(err)
+	}
+	if err := tpl.compile(); err != nil {
+		b.Fatal(err)
+	}
+	table := [1000][10]int{}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		tpl.execute(ioutil.Discard, table)
+	}
+}
+
 func Benchmark_bigtable2(b *testing.B) {
 	b.StopTimer()
 	bytes, err := ioutil.ReadFile(filepath.Join(TestsDir, "bigtable2.dmsl"))
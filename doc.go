@@ -13,6 +13,15 @@ document via an #id tag.
 	  #content.border Hello, World
 	  %div.one.two.three
 
+Documents are utf-8, with a leading byte order mark ignored and \r\n line endings read
+as \n. A tag name begins with an ascii letter and may hold the letters and
+other characters html allows in custom elements, such as %my-élément, while an #id or
+.class is a css identifier, holding ascii letters, digits, hyphens, underscores and
+non-ascii characters, and not beginning with a digit or a hyphen and digit.
+
+Void elements, such as %br, %img and %input, are written without an end tag and can
+not be given content. Parsing with parse.XHTML writes them self-closing instead, as <br />.
+
 Attributes
 
 Attributes can be inlined, line-breaked, or a combination of such. Provide
@@ -31,6 +40,12 @@ quotes around the attribute value to escape brackets.
 
 	  %span[a][b] Attributes do not require values
 
+Attributes without values are written as boolean attributes, such as <input disabled>,
+or as disabled="" with parse.XHTML. Within a value, a backslash escapes the character
+that follows it.
+
+	%a[title=one \] two][alt="say \"hi\""]
+
 Text and Whitespace
 
 Whitespace can be manipulated in various ways as described below, but it's worth pointing out that
@@ -55,6 +70,23 @@ Whitespace can be preserved using `
 	text and all whitespace
 	    is preserved as-is`
 
+Text and attribute values are escaped when written. Text following != is written as is,
+as are the content lines of the raw action, for html that is trusted.
+
+	%p != <b>trusted</b>
+	:raw
+	  <script src="/main.js"></script>
+
+When executed in the default Interpret mode, escaping is left to html/template, which
+escapes the values it inserts but not the text of the document.
+
+Nesting is determined by the number of tab and space characters indenting a line, and a
+line must dedent to the indentation of an open element. Parsing with parse.StrictIndent
+additionally rejects indentation mixing tabs and spaces such that its nesting would
+depend on the width of a tab, reporting the line.
+
+	t.DocMode(parse.StrictIndent)
+
 HTML Comments
 
 Supports commenting out blocks of code via html comments with optional
@@ -80,6 +112,19 @@ body tag in this case. You can also nest items under a comment.
 
 	  ![if IE] %p Internet Explorer
 
+A root comment beginning !DOCTYPE, in any case, is a doctype declaration. Only the first
+is written, so a document and the layout it extends may both declare one.
+
+Fragments
+
+A document is its first root element, along with any doctype and comments before it.
+Parsing with parse.Fragment instead writes every root node, such as for a partial
+rendered on its own, and an empty fragment is written as nothing. Overrides don't apply
+to fragments.
+
+	%li One
+	%li Two
+
 Actions
 
 There is basic support for actions. An action is just another way of calling a function
@@ -87,8 +132,8 @@ while also preserving indention of the inner content lines, making this suitable
 parsing other indention based markup. Once an action has been processed, the lexer will parse
 the result as though it was part of the original document.
 
-In time, this package will facilitate custom functions. Currently
-included actions are js, css, include, and extends.
+Included actions are js, css, raw, include, and extends. Custom actions, or
+replacements for those included, can be given to a template with Funcs before parsing.
 
 	%html %head
 	  :css /css/
@@ -101,6 +146,15 @@ This would generate the following document.
 	  %link[type=text/css][rel=stylesheet][href=/css/main.css]
 	  %link[type=text/css][rel=stylesheet][href=/css/extra.css]
 
+An action is a parse.ActionFn receiving the arguments and content lines of the action.
+The returned bytes are lexed in place of the action.
+
+	t := damsel.New().Funcs(parse.FuncMap{
+		"upper": func(a *parse.Action) ([]byte, error) {
+			return bytes.ToUpper(a.Args), nil
+		},
+	})
+
 Reusable Templates
 
 Damsel allows any element with an id specified to be overridden. Also required
@@ -132,6 +186,36 @@ If you wish to append child nodes instead of overriding the original content, sp
 	#content[super]
 	  %p A second paragraph
 
+A layout may itself extend another, such as a page extending a section layout that
+extends a base layout. Overrides apply in order from the base outward, so super adds to
+the content as the immediate parent left it. Files that extend or include one another in
+a cycle are reported as an error listing the files.
+
+Other attributes select other ways of overriding, and like super are removed from the output.
+
+	[super] or [append]  add child nodes after the original
+	[prepend]            add child nodes before the original
+	[before]             insert child nodes as siblings before the element
+	[after]              insert child nodes as siblings after the element
+	[replace]            replace the element itself, tag and attributes included
+	[remove]             remove the element, keeping the text after it
+
+For example, the following removes a sidebar and adds a script after the content.
+
+	:extends overlay.dmsl
+
+	#sidebar[remove]
+
+	#content[after]
+	  %script[src=app.js]
+
+Except when replacing or removing, the classes of an override are added to the element's,
+its attributes replace the element's, and a tag given explicitly replaces the element's
+tag. A keep attribute keeps the original value of the attributes it names, or of all
+attributes when given without a value.
+
+	#content.wide[title=Page][keep=title]
+
 The action include uses the whitespace preceding its declaration to insert
 content from a separate document into the current. For example, given the
 following document:
@@ -156,6 +240,38 @@ would produce the following document:
 	      %li One
 	      %li Two
 
+Files named by include and extends, and by ParseFile, are read from TemplateDir unless
+the template is given a Loader. FSLoader serves templates from any fs.FS, such as an
+embed.FS compiled into the binary.
+
+	//go:embed templates
+	var templates embed.FS
+
+	t := damsel.New().Loader(damsel.FSLoader(templates))
+	err := t.ParseFile("templates/index.dmsl")
+
+Template Sets
+
+A Set parses every .dmsl file of a file system once, resolving include and extends
+between them by path. Executing a template of a set only runs html/template and the
+final document parse, and is safe from many goroutines at once.
+
+	set, err := damsel.ParseSet(os.DirFS("templates"))
+	...
+	err = set.ExecuteTemplate(w, "index.dmsl", data)
+
+In development, a set that reloads checks the files of a template before each execution,
+including those it includes and extends, and parses it again if any changed, so edits are
+seen without restarting. Reloading is off unless set, as it should be in production.
+
+	set.Reload(*dev)
+
+Documents are written straight to an io.Writer, such as an http.ResponseWriter, without
+building the whole result as a string. A single template is executed the same way with
+Execute, while Render writes its document without html/template.
+
+	err = t.Execute(w, data)
+
 Other Template Integration
 
 This package should be ok for use with most text templating options. Helpers
@@ -175,6 +291,18 @@ to html/template.Template. Call Execute(interface{}) to produce the final result
 	      %td {.}
 	{end}{end}
 
+A template or set in Compile mode instead parses the document once, before html/template,
+carrying actions such as {range .} through to the html as text. Each execution then
+only runs html/template, which suits large documents such as the table above.
+
+	set := damsel.NewSet(fsys).Mode(damsel.Compile)
+	err := set.Parse()
+
+In Compile mode, a line holding only actions that open or close blocks is placed around
+the elements it encloses, so blocks must open and close within the same element. The
+second example below satisfies this, but a block that only conditionally opens an
+element requires the default Interpret mode.
+
 At one-point the {end} was optional with deeper integration of html/template, but in practice this created
 confusion and errors except for the most trivial of examples (above).
 
@@ -197,5 +325,100 @@ Here's another example.
 
 	    %p some trailing text
 	  {end}
+
+Document Tree
+
+The parse package returns a parsed document as a tree of elements with ParseTree, so it
+can be inspected or rewritten before being written with WriteTo.
+
+	doc, err := parse.ParseTree(src)
+	...
+	html := doc.Children()[0] // the first element, given no doctype
+	html.SetAttr("lang", "en")
+	_, err = doc.WriteTo(w)
+
+Elements are queried with css selectors using Find and FindAll, supporting tags, ids,
+classes, attributes, descendant and child combinators, and :nth-child. Both return an
+error for an invalid selector, while a Selector from ParseSelector is parsed once for
+repeated queries.
+
+	links, err := doc.FindAll("#nav > ul li:nth-child(odd) a[href^=http]")
+	...
+	for _, a := range links {
+		a.SetAttr("rel", "external")
+	}
+
+Source Maps
+
+Lines spliced in by include and extends keep the file and line they came from, so errors
+name the file at fault rather than the position in the combined document. RenderMap
+writes a template's document along with a map from the offset of each element in the
+html to its file and line, which encodes as json for a sidecar file. Alternatively, the
+parse.SourceComments mode writes the origin as a comment before each element.
+
+	t.DocMode(parse.SourceComments)
+	err := t.Render(w) // <!-- nav.dmsl:2 --><a>Home</a>
+
+Code Generation
+
+The compile package generates Go code rendering templates in Compile mode, so production
+programs don't parse templates at all. Each template becomes a render function writing
+precomputed static html and evaluating its actions on data with the semantics of
+html/template, escaping included.
+
+	damsel gen -dir templates -pkg views -o views/views.go index.dmsl layout/base.dmsl=Base
+
+	err := views.Index(w, data)
+
+The -type and -import flags give render functions a typed data parameter in place of
+interface{}. Fields and methods of the data are still looked up by reflection, as
+html/template does, so a misspelled name is an error when rendering, not compiling.
+Templates may call templates they define where the call is in html text.
+Generated code imports the compile/rt package, which holds code adapted from Go's
+template packages under the BSD license in compile/rt/LICENSE. It requires Go 1.23 or
+later, as rt uses the iter package to range over iterator functions as text/template does.
+The escapers of rt are copies, so security fixes to those of html/template don't reach
+generated code until they're ported to rt by hand. Its tests compare the output of each
+escaper with html/template on hostile input, so they fail when a Go release changes it.
+
+Building Directories
+
+The damsel command renders each template of a directory to an html file of the same path
+with build. Given -data, templates are executed with it as json.
+
+	damsel build -src templates -out public
+
+watch builds likewise, then polls the directory and renders templates again when they or
+any file they include or extend, transitively, changes. Files a template includes are
+listed by its Files method.
+
+	damsel watch -src templates -out public -interval 500ms
+
+Formatting
+
+fmt rewrites templates in a canonical form, as gofmt does Go files: nesting is indented
+with tabs, inline elements are written with their tag, ids and then classes, redundant
+attribute quotes are dropped and runs of blank lines are collapsed. Comments, text,
+escapes and actions are kept as written, and attribute order is kept as it is the order
+of the html. With no files, fmt formats standard input.
+
+	damsel fmt -l templates
+	damsel fmt -w index.dmsl
+
+The formatter is parse.Format, built on parse.ParseLines, which returns the lines of a
+document as a tree keeping the comments and blank lines the document parser discards.
+
+Converting HTML
+
+The convert package converts html documents to damsel, as does the damsel command with
+convert, writing file.dmsl next to each file.html given -w. Elements are written with
+the #id.class shorthand, leaving out %div where it has one, and an element whose only
+content is another is written on its line, as in %html %body. Whitespace is collapsed
+as html renders it, except in elements such as pre, whose text is escaped with
+backticks to keep it as is. Html is parsed as browsers parse it, by a vendored copy of
+golang.org/x/net/html, leaving out the elements it implies, such as head and body.
+
+	damsel convert -w index.html
+	b, err := convert.HTML(src)
 */
 package damsel
@@ -2,7 +2,10 @@ package damsel
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
+	"io"
+	"sync"
 
 	"dasa.cc/damsel/parse"
 )
@@ -35,10 +38,14 @@ func StrEq(a, b string) bool {
 }
 
 // HtmlTemplate is an inefficient example of external template integration that is also used with tests
-// using html/template.
+// using html/template. The Html template is parsed on first call to Execute, after which
+// Execute is safe for concurrent use.
 type HtmlTemplate struct {
 	Html *template.Template
 	Dmsl *Template
+
+	once sync.Once
+	err  error
 }
 
 func NewHtmlTemplate(tpl *Template) *HtmlTemplate {
@@ -49,17 +56,95 @@ func NewHtmlTemplate(tpl *Template) *HtmlTemplate {
 }
 
 func (t *HtmlTemplate) Execute(data interface{}) (string, error) {
-	_, err := t.Html.Parse(string(t.Dmsl.ParseResult()))
-	if err != nil {
-		return "", err
+	t.once.Do(func() {
+		_, t.err = t.Html.Parse(string(t.Dmsl.ParseResult()))
+	})
+	if t.err != nil {
+		return "", t.err
 	}
-	buf := &bytes.Buffer{}
-	if err := t.Html.Execute(buf, data); err != nil {
+	var buf bytes.Buffer
+	if err := executeHtml(&buf, t.Html, t.Dmsl, data); err != nil {
 		return "", err
 	}
-	r, err := parse.DocParse(buf.Bytes())
+	return buf.String(), nil
+}
+
+// Mode selects how a template's document and html/template are combined when executed.
+type Mode int
+
+const (
+	// Interpret executes html/template with the result of the action phase and parses the
+	// document from its output on each execution. Template actions may be placed anywhere in
+	// the outline, such as to open an element conditionally. As html/template sees the
+	// outline rather than html, it escapes a < in the text of a script or style element.
+	Interpret Mode = iota
+
+	// Compile parses the document once, carrying template actions through to html, so each
+	// execution only runs html/template. Blocks of template actions must open and close
+	// within the same element, and html comments are removed by html/template.
+	Compile
+)
+
+// compileOnce compiles the template on first call, returning the same error thereafter.
+func (t *Template) compileOnce() error {
+	t.once.Do(func() { t.err = t.compile() })
+	return t.err
+}
+
+// compile parses the result of the template's action phase with html/template, first
+// parsing the document if the template's mode is Compile.
+func (t *Template) compile() error {
+	src := string(t.result)
+	if t.mode == Compile {
+		doc, err := t.docParser().Origins(t.origins).Delims(LeftDelim, RightDelim).Parse(t.result)
+		if err != nil {
+			return err
+		}
+		src = doc
+	}
+	html, err := template.New(t.name).Delims(LeftDelim, RightDelim).Funcs(funcMap).Parse(src)
 	if err != nil {
-		return "", err
+		return err
+	}
+	t.html = html
+	return nil
+}
+
+// Compiled returns the html/template a template in Compile mode is compiled to, compiling
+// it on first call. The html/template is parsed with the delimiters and functions damsel
+// gives to html/template, and must not be modified.
+func (t *Template) Compiled() (*template.Template, error) {
+	if t.mode != Compile {
+		return nil, fmt.Errorf("damsel: template %s is not in Compile mode", t.name)
+	}
+	if err := t.compileOnce(); err != nil {
+		return nil, err
+	}
+	return t.html, nil
+}
+
+// execute applies the compiled template to data and writes the document to w.
+func (t *Template) execute(w io.Writer, data interface{}) error {
+	if t.mode == Compile {
+		return t.html.Execute(w, data)
+	}
+	return executeHtml(w, t.html, t, data)
+}
+
+// executeHtml executes html with data and writes the document of dmsl parsed from the result to w.
+// The lines of the result aren't those of dmsl's files, so errors parsing it are located
+// in the result, named as the output of html/template.
+func executeHtml(w io.Writer, html *template.Template, dmsl *Template, data interface{}) error {
+	var buf bytes.Buffer
+	if err := html.Execute(&buf, data); err != nil {
+		return err
+	}
+	name := "html/template output"
+	if dmsl.name != "" {
+		name += " of " + dmsl.name
 	}
-	return r, nil
+	p := parse.NewDocParser(name)
+	// html/template has already escaped the values it inserted
+	p.Mode = dmsl.docMode | parse.NoEscape
+	return p.Render(w, buf.Bytes())
 }
@@ -0,0 +1,59 @@
+package damsel
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Loader provides template source by name to ParseFile and the include and extends actions.
+type Loader interface {
+	Load(name string) ([]byte, error)
+}
+
+type fsLoader struct {
+	fsys fs.FS
+}
+
+// FSLoader returns a Loader reading templates from fsys, such as an embed.FS. Names are
+// slash-separated and relative to the root of fsys; a leading slash is ignored.
+func FSLoader(fsys fs.FS) Loader {
+	return fsLoader{fsys}
+}
+
+type dirLoader string
+
+// DirLoader returns a Loader reading templates from the directory dir. Names are file
+// paths joined to dir as by filepath.Join, so with an empty dir they may be absolute or
+// relative to the working directory, and may name files outside of dir with "..".
+func DirLoader(dir string) Loader {
+	return dirLoader(dir)
+}
+
+func (l fsLoader) Load(name string) ([]byte, error) {
+	return fs.ReadFile(l.fsys, cleanName(name))
+}
+
+func (l dirLoader) Load(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(l), filepath.FromSlash(name)))
+}
+
+// fileName returns name as files are named by loader: cleaned as by FSLoader for a file
+// system, and as given, less surrounding whitespace, otherwise.
+func fileName(loader Loader, name string) string {
+	if _, ok := loader.(fsLoader); ok {
+		return cleanName(name)
+	}
+	return strings.TrimSpace(name)
+}
+
+// cleanName converts a template name to a path valid for fs.FS.
+func cleanName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.TrimSpace(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
@@ -0,0 +1,296 @@
+package parse
+
+import "bytes"
+
+// Template actions, such as {range .} with delimiters "{" and "}", are carried through to the
+// result as text when a DocParser is given delimiters with Delims. Actions that open or close
+// a block of the template are placed so that the block holds the same elements in the result
+// as it does in the outline.
+//
+// An action inlined with an element's text is kept with that text. A line holding nothing but
+// actions is a directive. An opening directive is placed before the content that follows it,
+// while else and end are placed after the content that precedes them, moved up to the element
+// holding the block's opening action. A block must therefore open and close within the same
+// element, and no element may gain content after the end of a block that holds it.
+
+type actionKind int
+
+const (
+	actionOther actionKind = iota
+	actionOpen
+	actionElse
+	actionEnd
+)
+
+// segment is a run of text or a template action found within text.
+type segment struct {
+	b      []byte
+	action bool
+}
+
+// block is an open template block and the element whose content holds it.
+type block struct {
+	name      string
+	pos       int
+	container *Elem
+}
+
+// mark is a place content can be written to, either the text of el or the tail after el.
+type mark struct {
+	el   *Elem
+	tail bool
+}
+
+func (m mark) container() *Elem {
+	if m.tail {
+		return m.el.parent
+	}
+	return m.el
+}
+
+func (m mark) append(c chunk) {
+	if m.tail {
+		m.el.tail = append(m.el.tail, c)
+	} else {
+		m.el.text = append(m.el.text, c)
+	}
+}
+
+// Delims sets the delimiters of template actions to be carried through to the result. An
+// empty left delimiter, the default, treats actions as plain text.
+func (p *DocParser) Delims(left, right string) *DocParser {
+	p.leftDelim, p.rightDelim = []byte(left), []byte(right)
+	return p
+}
+
+// splitActions splits b into text and template actions.
+func (p *DocParser) splitActions(b []byte) []segment {
+	return splitActions(b, p.leftDelim, p.rightDelim)
+}
+
+// splitActions splits b into text and template actions delimited by left and right.
+func splitActions(b []byte, left, right []byte) []segment {
+	var segs []segment
+	for len(b) > 0 {
+		i := bytes.Index(b, left)
+		if i == -1 {
+			break
+		}
+		j := indexRightDelim(b[i+len(left):], right)
+		if j == -1 {
+			break
+		}
+		j += i + len(left) + len(right)
+		if i > 0 {
+			segs = append(segs, segment{b: b[:i]})
+		}
+		segs = append(segs, segment{b: b[i:j], action: true})
+		b = b[j:]
+	}
+	if len(b) > 0 {
+		segs = append(segs, segment{b: b})
+	}
+	return segs
+}
+
+// indexRightDelim returns the index of right in b, skipping over quoted strings, or -1.
+func indexRightDelim(b []byte, right []byte) int {
+	var quote byte
+	for i := 0; i < len(b); i++ {
+		switch {
+		case quote != 0:
+			if b[i] == '\\' && quote != '`' {
+				i++
+			} else if b[i] == quote {
+				quote = 0
+			}
+		case b[i] == '"' || b[i] == '\'' || b[i] == '`':
+			quote = b[i]
+		case bytes.HasPrefix(b[i:], right):
+			return i
+		}
+	}
+	return -1
+}
+
+// kindOf returns how the action affects blocks of the template along with its keyword.
+func (p *DocParser) kindOf(action []byte) (actionKind, string) {
+	b := action[len(p.leftDelim) : len(action)-len(p.rightDelim)]
+	if len(b) > 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	fields := bytes.Fields(b)
+	if len(fields) == 0 {
+		return actionOther, ""
+	}
+	switch name := string(fields[0]); name {
+	case "if", "range", "with", "block", "define":
+		return actionOpen, name
+	case "else":
+		return actionElse, name
+	case "end":
+		return actionEnd, name
+	default:
+		return actionOther, name
+	}
+}
+
+// directive returns the actions of text if it consists of nothing but actions and at least
+// one of them opens or closes a block.
+func (p *DocParser) directive(text []byte) []segment {
+	segs := p.splitActions(text)
+	structural := false
+	for _, seg := range segs {
+		if !seg.action {
+			if len(bytes.TrimSpace(seg.b)) != 0 {
+				return nil
+			}
+			continue
+		}
+		if k, _ := p.kindOf(seg.b); k != actionOther {
+			structural = true
+		}
+	}
+	if !structural {
+		return nil
+	}
+	return segs
+}
+
+// placeText writes text at m, tracking any blocks opened or closed by actions within it.
+func (p *DocParser) placeText(m mark, t Token, raw bool) {
+	text := p.lex.bytes[t.start:t.end]
+	p.checkSealed(m.container(), t.start)
+	p.flushPending(m)
+	m.append(chunk{b: text, raw: raw})
+	p.last = m
+
+	pos := t.start
+	for _, seg := range p.splitActions(text) {
+		if seg.action {
+			switch k, name := p.kindOf(seg.b); k {
+			case actionOpen:
+				p.blocks = append(p.blocks, &block{name: name, pos: pos, container: m.container()})
+			case actionElse, actionEnd:
+				b := p.closeBlock(seg.b, pos, k)
+				if b.container != m.container() {
+					p.errorf(pos, "%s closes block opened by %s in another element", seg.b, b.name)
+				}
+			}
+		}
+		pos += len(seg.b)
+	}
+}
+
+// placeDirective places the actions of a directive line beginning at pos.
+func (p *DocParser) placeDirective(segs []segment, pos int) {
+	for _, seg := range segs {
+		if !seg.action {
+			pos += len(seg.b)
+			continue
+		}
+		k, name := p.kindOf(seg.b)
+		if k == actionOpen {
+			p.blocks = append(p.blocks, &block{name: name, pos: pos})
+			p.pending = append(p.pending, seg.b)
+			pos += len(seg.b)
+			continue
+		}
+		if p.last.el == nil {
+			p.errorf(pos, "template action %s outside of element", seg.b)
+		}
+		p.flushPending(p.last)
+
+		container := p.last.container()
+		if k != actionOther {
+			container = p.closeBlock(seg.b, pos, k).container
+		} else if len(p.blocks) != 0 {
+			container = p.blocks[len(p.blocks)-1].container
+		}
+		m := p.hoist(p.last, container)
+		if m.el == nil {
+			p.errorf(pos, "%s is outside of the element holding its block", seg.b)
+		}
+		if m.tail {
+			p.sealed[m.el] = true
+		}
+		m.append(chunk{b: seg.b})
+		p.last = m
+		pos += len(seg.b)
+	}
+}
+
+// closeBlock pops the innermost block for an else or end action, returning the block.
+func (p *DocParser) closeBlock(action []byte, pos int, k actionKind) *block {
+	if len(p.blocks) == 0 {
+		p.errorf(pos, "unexpected %s", action)
+	}
+	b := p.blocks[len(p.blocks)-1]
+	if k == actionEnd {
+		p.blocks = p.blocks[:len(p.blocks)-1]
+	}
+	return b
+}
+
+// hoist returns the mark following m within container, or the zero mark if m is not held
+// by container.
+func (p *DocParser) hoist(m mark, container *Elem) mark {
+	if m.container() == container {
+		return m
+	}
+	for el := m.container(); el != nil; el = el.parent {
+		if el.parent == container {
+			return mark{el: el, tail: true}
+		}
+	}
+	return mark{}
+}
+
+// flushPending places opening directives waiting on content at m.
+func (p *DocParser) flushPending(m mark) {
+	if len(p.pending) == 0 {
+		return
+	}
+	for _, b := range p.blocks {
+		if b.container == nil {
+			b.container = m.container()
+		}
+	}
+	for _, b := range p.pending {
+		m.append(chunk{b: b})
+	}
+	p.pending = p.pending[:0]
+}
+
+// placeElem records el as content, placing any opening directives before it.
+func (p *DocParser) placeElem(el *Elem, pos int) {
+	p.checkSealed(el.parent, pos)
+	if len(p.pending) != 0 {
+		if n := len(el.parent.children); n > 1 {
+			p.flushPending(mark{el: el.parent.children[n-2], tail: true})
+		} else {
+			p.flushPending(mark{el: el.parent})
+		}
+	}
+	p.last = mark{el: el, tail: true}
+}
+
+// checkSealed errors if content is added to el after the end of a block holding it.
+func (p *DocParser) checkSealed(el *Elem, pos int) {
+	if len(p.sealed) == 0 {
+		return
+	}
+	for ; el != nil; el = el.parent {
+		if p.sealed[el] {
+			p.errorf(pos, "content nested in element %s after the end of its template block", el.tag)
+		}
+	}
+}
+
+// closeDirectives errors for any blocks left open at the end of the document.
+func (p *DocParser) closeDirectives() {
+	if len(p.blocks) != 0 {
+		b := p.blocks[len(p.blocks)-1]
+		p.errorf(b.pos, "unclosed %s block", b.name)
+	}
+}
@@ -1,6 +1,11 @@
 package parse
 
-import "bytes"
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
 
 const (
 	LeftCarrot   = '<'
@@ -21,17 +26,69 @@ var DefaultTag []byte = []byte("div")
 var AttrId []byte = []byte("id")
 var AttrClass []byte = []byte("class")
 
+// NodeType is the type of an Elem.
+type NodeType int
+
+const (
+	ElementNode  NodeType = iota // an html element, such as %p
+	CommentNode                  // an html comment, such as ! text
+	DocumentNode                 // the root of a document returned by ParseTree
+	DoctypeNode                  // a doctype declaration, such as !DOCTYPE html
+)
+
 type Elem struct {
-	parent    *Elem
-	children  []*Elem
-	ws        int
-	tag       []byte
-	id        []byte
-	class     [][]byte
-	attr      [][][]byte
-	text      [][]byte
-	tail      [][]byte
-	isComment bool
+	parent   *Elem
+	children []*Elem
+	ws       int
+	pos      int
+	typ      NodeType
+	tag      []byte
+	hasTag   bool // tag was given explicitly rather than defaulting to DefaultTag
+	id       []byte
+	class    [][]byte
+	attr     [][][]byte
+	text     []chunk
+	tail     []chunk
+}
+
+// chunk is a run of text content, raw if it's to be written without escaping.
+type chunk struct {
+	b   []byte
+	raw bool
+}
+
+// voidElements are html elements that have no content and no end tag.
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// isVoid reports whether el is a void element, such as br or img.
+func (el *Elem) isVoid() bool {
+	return el.typ == ElementNode && voidElements[string(el.tag)]
+}
+
+// rawTextElements are html elements whose text is not decoded, so it's written without
+// escaping.
+var rawTextElements = map[string]bool{
+	"script": true,
+	"style":  true,
+}
+
+func (el *Elem) isRawText() bool {
+	return el.typ == ElementNode && rawTextElements[string(el.tag)]
 }
 
 func (el *Elem) SubElement() *Elem {
@@ -41,10 +98,124 @@ func (el *Elem) SubElement() *Elem {
 }
 
 func (el *Elem) String() string {
-	//buf := new(bytes.Buffer)
-	var buf bytes.Buffer
-	el.ToString(&buf, Pprint)
-	return buf.String()
+	var b strings.Builder
+	el.print(&printer{buf: &b, pprint: Pprint})
+	return b.String()
+}
+
+// ToString writes the html of el to buf, escaping text and attribute values.
+func (el *Elem) ToString(buf *bytes.Buffer, pprint bool) {
+	el.print(&printer{buf: buf, pprint: pprint})
+}
+
+// WriteTo writes the html of el to w, escaping text and attribute values. Output is
+// buffered, with the buffer flushed before returning.
+func (el *Elem) WriteTo(w io.Writer) (int64, error) {
+	return render(w, []*Elem{el}, printer{pprint: Pprint})
+}
+
+// render writes the html of elems to w with the options of p, whose buf is replaced.
+func render(w io.Writer, elems []*Elem, p printer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	p.buf = bw
+	if p.src != nil {
+		p.src.offset = func() int64 { return cw.n + int64(bw.Buffered()) }
+	}
+	for _, el := range elems {
+		el.print(&p)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// writer is implemented by the buffers elements are printed to. Write errors are not
+// checked while printing, so a writer must keep the first error, as bufio.Writer does,
+// or have none to report.
+type writer interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+	WriteRune(r rune) (int, error)
+}
+
+// printer holds options for writing the html of elements.
+type printer struct {
+	buf        writer
+	pprint     bool
+	mode       Mode
+	leftDelim  []byte
+	rightDelim []byte
+	src        *sourceInfo // records origins of elements, if set
+}
+
+// write writes text content, escaping it unless raw.
+func (p *printer) write(c chunk) {
+	if c.raw {
+		p.buf.Write(c.b)
+	} else {
+		p.escape(c.b, false)
+	}
+}
+
+// escape writes b with html special characters escaped, unless the printer's mode
+// includes NoEscape. Template actions are written as is.
+func (p *printer) escape(b []byte, attr bool) {
+	if p.mode&NoEscape != 0 {
+		p.buf.Write(b)
+		return
+	}
+	if p.leftDelim == nil {
+		escape(p.buf, b, attr)
+		return
+	}
+	for _, seg := range splitActions(b, p.leftDelim, p.rightDelim) {
+		if seg.action {
+			p.buf.Write(seg.b)
+		} else {
+			escape(p.buf, seg.b, attr)
+		}
+	}
+}
+
+// escape writes b to buf, replacing characters special to html text, or to double quoted
+// attribute values if attr is true, with entities.
+func escape(buf writer, b []byte, attr bool) {
+	last := 0
+	for i, c := range b {
+		var esc string
+		switch c {
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '"':
+			if !attr {
+				continue
+			}
+			esc = "&#34;"
+		default:
+			continue
+		}
+		buf.Write(b[last:i])
+		buf.WriteString(esc)
+		last = i + 1
+	}
+	buf.Write(b[last:])
 }
 
 func contains(container [][]byte, item []byte) bool {
@@ -56,85 +227,95 @@ func contains(container [][]byte, item []byte) bool {
 	return false
 }
 
-func (el *Elem) ToString(buf *bytes.Buffer, pprint bool) {
+func (el *Elem) print(p *printer) {
+
+	if el.typ == DocumentNode {
+		for _, child := range el.children {
+			child.print(p)
+		}
+		return
+	}
 
-	// TODO get this doctype if out of here
-	if el.isComment && len(el.text) > 0 && bytes.Contains(el.text[0], []byte("DOCTYPE")) {
-		buf.WriteRune(LeftCarrot)
-		buf.WriteRune(Exclamation)
+	if el.typ == DoctypeNode {
+		p.buf.WriteRune(LeftCarrot)
+		p.buf.WriteRune(Exclamation)
 		for _, text := range el.text {
-			buf.Write(text)
+			p.buf.Write(text.b)
 		}
-		buf.WriteRune(RightCarrot)
-		buf.WriteRune(LineBreak)
+		p.buf.WriteRune(RightCarrot)
+		p.buf.WriteRune(LineBreak)
 		return
 	}
 	// TODO get this `if` out of here
-	if el.isComment {
-		buf.WriteRune(LeftCarrot)
-		buf.WriteRune(Exclamation)
-		buf.WriteRune(Hyphen)
-		buf.WriteRune(Hyphen)
+	if el.typ == CommentNode {
+		p.buf.WriteRune(LeftCarrot)
+		p.buf.WriteRune(Exclamation)
+		p.buf.WriteRune(Hyphen)
+		p.buf.WriteRune(Hyphen)
 
 		isCond := len(el.attr) == 1
 
 		if isCond {
-			buf.WriteRune(LeftBracket)
-			buf.Write(el.attr[0][0])
-			buf.WriteRune(RightBracket)
-			buf.WriteRune(RightCarrot)
+			p.buf.WriteRune(LeftBracket)
+			p.buf.Write(el.attr[0][0])
+			p.buf.WriteRune(RightBracket)
+			p.buf.WriteRune(RightCarrot)
 		} else {
 			for _, text := range el.text {
-				buf.Write(text)
+				p.buf.Write(text.b)
 			}
 		}
 
 		for _, child := range el.children {
-			child.ToString(buf, pprint)
+			child.print(p)
 		}
 
 		if isCond {
-			buf.WriteString("<![endif]-->")
+			p.buf.WriteString("<![endif]-->")
 		} else {
-			buf.WriteRune(Hyphen)
-			buf.WriteRune(Hyphen)
-			buf.WriteRune(RightCarrot)
+			p.buf.WriteRune(Hyphen)
+			p.buf.WriteRune(Hyphen)
+			p.buf.WriteRune(RightCarrot)
 		}
 		return
 	}
 
 	keys := [][]byte{}
 
-	if pprint {
+	if p.pprint {
 		for i := 0; i < el.ws; i++ {
-			buf.WriteRune(Space)
+			p.buf.WriteRune(Space)
 		}
 	}
 
-	buf.WriteRune(LeftCarrot)
-	buf.Write(el.tag)
+	if p.src != nil {
+		p.src.mark(p, el)
+	}
+
+	p.buf.WriteRune(LeftCarrot)
+	p.buf.Write(el.tag)
 
 	if el.id != nil {
-		buf.WriteRune(Space)
-		buf.Write(AttrId)
-		buf.WriteRune(Equal)
-		buf.WriteRune(Quote)
-		buf.Write(el.id)
-		buf.WriteRune(Quote)
+		p.buf.WriteRune(Space)
+		p.buf.Write(AttrId)
+		p.buf.WriteRune(Equal)
+		p.buf.WriteRune(Quote)
+		p.escape(el.id, true)
+		p.buf.WriteRune(Quote)
 	}
 
 	if el.class != nil {
-		buf.WriteRune(Space)
-		buf.Write(AttrClass)
-		buf.WriteRune(Equal)
-		buf.WriteRune(Quote)
+		p.buf.WriteRune(Space)
+		p.buf.Write(AttrClass)
+		p.buf.WriteRune(Equal)
+		p.buf.WriteRune(Quote)
 		for i, bytes := range el.class {
 			if i != 0 { // no space for first attr value
-				buf.WriteRune(Space)
+				p.buf.WriteRune(Space)
 			}
-			buf.Write(bytes)
+			p.escape(bytes, true)
 		}
-		buf.WriteRune(Quote)
+		p.buf.WriteRune(Quote)
 	}
 
 	for _, v := range el.attr {
@@ -142,55 +323,71 @@ func (el *Elem) ToString(buf *bytes.Buffer, pprint bool) {
 			continue
 		}
 
-		buf.WriteRune(Space)
-		buf.Write(v[0])
-		buf.WriteRune(Equal)
-		buf.WriteRune(Quote)
-		buf.Write(v[1])
-		buf.WriteRune(Quote)
+		p.buf.WriteRune(Space)
+		p.buf.Write(v[0])
+		// attributes without a value are boolean, written as just the key except in xhtml
+		if v[1] != nil || p.mode&XHTML != 0 {
+			p.buf.WriteRune(Equal)
+			p.buf.WriteRune(Quote)
+			p.escape(v[1], true)
+			p.buf.WriteRune(Quote)
+		}
 
 		keys = append(keys, v[0])
 	}
 
-	buf.WriteRune(RightCarrot)
+	if el.isVoid() {
+		if p.mode&XHTML != 0 {
+			p.buf.WriteRune(Space)
+			p.buf.WriteRune(Slash)
+		}
+		p.buf.WriteRune(RightCarrot)
+	} else {
+		p.buf.WriteRune(RightCarrot)
 
-	for _, text := range el.text {
-		if pprint && len(el.children) != 0 {
-			buf.WriteRune(LineBreak)
-			for i := 0; i < el.children[0].ws; i++ {
-				buf.WriteRune(Space)
+		for _, text := range el.text {
+			if p.pprint && len(el.children) != 0 {
+				p.buf.WriteRune(LineBreak)
+				for i := 0; i < el.children[0].ws; i++ {
+					p.buf.WriteRune(Space)
+				}
+			}
+			if el.isRawText() {
+				p.buf.Write(text.b)
+			} else {
+				p.write(text)
 			}
 		}
-		buf.Write(text)
-	}
 
-	for _, child := range el.children {
-		if pprint {
-			buf.WriteRune(LineBreak)
-		}
-		child.ToString(buf, pprint)
-		if pprint {
-			buf.WriteRune(LineBreak)
+		for _, child := range el.children {
+			if p.pprint {
+				p.buf.WriteRune(LineBreak)
+			}
+			child.print(p)
+			if p.pprint {
+				p.buf.WriteRune(LineBreak)
+			}
 		}
-	}
 
-	if pprint && len(el.children) != 0 {
-		for i := 0; i < el.ws; i++ {
-			buf.WriteRune(Space)
+		if p.pprint && len(el.children) != 0 {
+			for i := 0; i < el.ws; i++ {
+				p.buf.WriteRune(Space)
+			}
 		}
+
+		p.buf.WriteRune(LeftCarrot)
+		p.buf.WriteRune(Slash)
+		p.buf.Write(el.tag)
+		p.buf.WriteRune(RightCarrot)
 	}
 
-	buf.WriteRune(LeftCarrot)
-	buf.WriteRune(Slash)
-	buf.Write(el.tag)
-	buf.WriteRune(RightCarrot)
 	for _, text := range el.tail {
-		if pprint {
-			buf.WriteRune(LineBreak)
+		if p.pprint {
+			p.buf.WriteRune(LineBreak)
 			for i := 0; i < el.ws; i++ {
-				buf.WriteRune(Space)
+				p.buf.WriteRune(Space)
 			}
 		}
-		buf.Write(text)
+		p.write(text)
 	}
 }
@@ -0,0 +1,52 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Error is returned by the parsers for malformed documents. It records where in the
+// source the problem was found along with the line of source it occurred on.
+type Error struct {
+	Name    string // name of the document, if known
+	Line    int    // 1-based line number
+	Col     int    // 1-based column, counted in characters
+	Snippet string // source line the error occurred on
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("damsel: %d:%d: %v", e.Line, e.Col, e.Err)
+	}
+	return fmt.Sprintf("damsel: %s:%d:%d: %v", e.Name, e.Line, e.Col, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError returns an *Error for err located at byte offset pos of src.
+func newError(name string, src []byte, pos int, err error) *Error {
+	if pos > len(src) {
+		pos = len(src)
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	start := bytes.LastIndexByte(src[:pos], '\n') + 1
+	end := bytes.IndexByte(src[pos:], '\n')
+	if end == -1 {
+		end = len(src)
+	} else {
+		end += pos
+	}
+	return &Error{
+		Name:    name,
+		Line:    bytes.Count(src[:start], []byte{'\n'}) + 1,
+		Col:     utf8.RuneCount(src[start:pos]) + 1,
+		Snippet: string(src[start:end]),
+		Err:     err,
+	}
+}
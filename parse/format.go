@@ -0,0 +1,549 @@
+package parse
+
+import (
+	"bytes"
+	"io"
+)
+
+// LineKind is the kind of a Line.
+type LineKind int
+
+const (
+	BlankLine   LineKind = iota // a line of whitespace
+	ElemLine                    // elements, such as %p.intro Hello, along with what follows them
+	AttrLine                    // attributes continuing an element on a line of their own
+	TextLine                    // text, such as \ more text or != raw text
+	CommentLine                 // a / comment, which is not written to the document
+	ActionLine                  // an action along with its content lines, not yet evaluated
+)
+
+// Line is a line of a document's concrete syntax tree. Unlike the tree of ParseTree, it
+// keeps what parsing a document otherwise discards: comments, the backslash and backtick
+// forms of text, and actions as written.
+type Line struct {
+	Kind  LineKind
+	Depth int // nesting level of the line, as it's indented by Format
+
+	// Elems are the elements of an ElemLine, inline elements following the first, or of
+	// an AttrLine, an element without selectors holding its attributes.
+	Elems []*LineElem
+
+	// Text is the remainder of the line following any elements, as written: text with
+	// any escape, != raw text, a / comment, or an action's name and arguments, along
+	// with the whitespace before an action following elements. Text escaped with
+	// backticks may continue over following lines.
+	Text []byte
+
+	// Space reports whether whitespace separates Elems from Text, as in %p text and
+	// unlike !DOCTYPE html.
+	Space bool
+
+	// Content holds the content lines of an action, with the indentation of the action
+	// removed.
+	Content [][]byte
+
+	Children []*Line
+}
+
+// LineElem is an element as written in a Line.
+type LineElem struct {
+	Comment bool // an html comment, written !
+	Tag     []byte
+	IDs     [][]byte
+	Classes [][]byte
+	Attrs   []LineAttr
+}
+
+// LineAttr is an attribute as written in a Line.
+type LineAttr struct {
+	Key      []byte
+	Value    []byte // as written, including any quotes and escapes
+	HasValue bool
+}
+
+// ParseLines parses src as a damsel document and returns its concrete syntax tree, the
+// lines at depth zero with deeper lines as their children.
+func ParseLines(src []byte) ([]*Line, error) {
+	return NewDocParser("").ParseLines(src)
+}
+
+// Format returns src formatted in canonical form, such as by damsel fmt.
+func Format(src []byte) ([]byte, error) {
+	return NewDocParser("").Format(src)
+}
+
+// Format returns src formatted in canonical form. Lines are indented by a tab for each
+// level of nesting, and by one more where text follows the indented root elements leading
+// the document, blank lines are collapsed and trailing ones removed, and selectors
+// are written as %tag#id.class with redundant quotes of attribute values removed.
+// Comments, text and actions are kept as written, and the order of attributes is kept
+// since it's the order they are written to the document. The formatted source parses
+// to the same document as src. A returned error will be of type *Error.
+func (p *DocParser) Format(src []byte) ([]byte, error) {
+	lines, err := p.ParseLines(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := WriteLines(&buf, lines); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseLines parses src as a damsel document and returns its concrete syntax tree, the
+// lines at depth zero with deeper lines as their children. Actions are not evaluated,
+// and a line is nested as it would be once they are, given each action expands to lines
+// at its own indentation. A returned error will be of type *Error.
+func (p *DocParser) ParseLines(src []byte) (lines []*Line, err error) {
+	defer recoverError(&err)
+	lp := &lineParser{root: &lineElem{}, action: -1}
+	p.lex = NewLexer(lp)
+	p.lex.name = p.name
+	p.lex.bytes = src
+	lp.lex = p.lex
+	p.lex.Run()
+	if p.lex.err != nil {
+		return nil, p.lex.err
+	}
+	return nest(lp.lines()), nil
+}
+
+// lineParser collects the tokens of a document to group them into lines.
+type lineParser struct {
+	lex  *lexer
+	toks []Token
+
+	// the nesting of elements, as tracked by DocParser
+	root          *lineElem
+	cur           *lineElem
+	curWs, prevWs int
+	cache         []*lineElem
+
+	// action is the depth past which a line following an action continues it, or -1
+	action int
+
+	// of the line last parsed, whether it's text of the document's root, following an
+	// indented root element, and whether it's written at a fixed indentation
+	rootText, fixed bool
+}
+
+// lineElem is an element tracked by its indentation ws, as DocParser counts it, and the
+// indentation f it's formatted at, counted alike.
+type lineElem struct {
+	ws, f  int
+	parent *lineElem
+}
+
+func (lp *lineParser) ReceiveToken(t Token) {
+	lp.toks = append(lp.toks, t)
+}
+
+// errorf halts parsing with an error located at pos of the document.
+func (lp *lineParser) errorf(pos int, msg string) {
+	panic(lp.lex.errorAt(pos, &formatError{msg}))
+}
+
+type formatError struct{ msg string }
+
+func (e *formatError) Error() string { return e.msg }
+
+// lines groups the tokens of the document into lines, a line continuing past its end for
+// text escaped with backticks and the content of actions. Text of the document's root can
+// only follow root elements that are indented, so the lines leading to it are indented
+// by a tab.
+func (lp *lineParser) lines() []*Line {
+	b := lp.lex.bytes
+	var lines, lead []*Line
+	for pos, i := 0, 0; pos < len(b); {
+		end := lineEnd(b, pos)
+		j := i
+		for ; j < len(lp.toks); j++ {
+			t := lp.toks[j]
+			content := t.typ == TokenActionContent || t.typ == TokenActionContentWs
+			// the token of an empty comment follows the ! at the end of its line
+			comment := t.typ == TokenComment && t.start == end
+			if t.typ == TokenActionEnd || t.start >= end && !content && !comment {
+				break
+			}
+			if t.end > end || content && t.start > end {
+				end = lineEnd(b, t.end)
+			}
+		}
+		if j < len(lp.toks) && lp.toks[j].typ == TokenActionEnd && lp.toks[j].start <= end+1 {
+			// the action ends with the line before that ending it
+			j++
+		}
+		l, blank := lp.line(b[pos:end], pos, lp.toks[i:j])
+		lines = append(lines, l)
+		if !lp.fixed {
+			lead = append(lead, l)
+		}
+		if lp.rootText {
+			for _, l := range lead {
+				l.Depth++
+			}
+			lead = nil
+		}
+		if blank {
+			lines = append(lines, &Line{Kind: BlankLine})
+		}
+		pos, i = end+1, j
+	}
+	return lines
+}
+
+// lineEnd returns the position of the line break ending the line holding pos, or the
+// end of b.
+func lineEnd(b []byte, pos int) int {
+	if i := bytes.IndexByte(b[pos:], '\n'); i != -1 {
+		return pos + i
+	}
+	return len(b)
+}
+
+// line returns the line of source src, found at pos of the document, given its tokens,
+// and whether blank lines that ended an action's content follow it.
+func (lp *lineParser) line(src []byte, pos int, toks []Token) (*Line, bool) {
+	indent := len(src) - len(bytes.TrimLeft(src, " \t"))
+	comment := bytes.TrimRight(src[indent:], " \t")
+	if len(toks) == 0 && len(comment) == 0 {
+		return &Line{Kind: BlankLine}, false
+	}
+	// a line following an action, unless it continues it, is indented no further
+	action := lp.action
+	lp.action, lp.rootText, lp.fixed = -1, false, false
+	if len(toks) == 0 {
+		return &Line{Kind: CommentLine, Depth: lp.textDepth(indent*2, pos, true), Text: comment}, false
+	}
+
+	l := &Line{Kind: TextLine}
+	switch toks[0].typ {
+	case TokenElement:
+		l.Kind = ElemLine
+	case TokenAttrKey:
+		l.Kind = AttrLine
+		if lp.cur != nil {
+			l.Depth = lp.cur.f/2 + 1
+		}
+		if action != -1 && l.Depth > action {
+			l.Depth, lp.fixed = action, true
+		}
+	case TokenTextWs:
+		l.Kind = TextLine
+		l.Depth = lp.textDepth(CountWs(toks[0]), toks[0].start, false)
+	case TokenActionStart:
+		l.Kind = ActionLine
+		l.Depth = lp.elem(toks[0], true) / 2
+		lp.action = l.Depth
+		first := lineEnd(src, 0)
+		l.Text = src[indent:first]
+		for _, c := range bytes.Split(src[first:], []byte("\n"))[1:] {
+			ws := len(c) - len(bytes.TrimLeft(c, " \t"))
+			if ws == len(c) {
+				c = nil
+			} else if ws > indent {
+				c = c[indent:]
+			} else {
+				c = c[ws:]
+			}
+			l.Content = append(l.Content, c)
+		}
+		// trailing blank lines are left to follow the action
+		n := len(l.Content)
+		for n > 0 && l.Content[n-1] == nil {
+			n--
+		}
+		blank := n != len(l.Content)
+		l.Content = l.Content[:n]
+		return l, blank
+	}
+
+	// the first token of an ElemLine sets its depth
+	for k, t := range toks {
+		if t.typ == TokenElement {
+			lineStart := t.start == 0 || lp.lex.bytes[t.start-1] == '\n'
+			f := lp.elem(t, lineStart)
+			if k == 0 {
+				l.Depth = f / 2
+			}
+		}
+	}
+
+	if l.Kind == TextLine {
+		l.Text = src[indent:]
+		return l, false
+	}
+	end := pos + indent
+	l.Elems, end = lp.chain(toks, end)
+	rest := lp.lex.bytes[end : pos+len(src)]
+	text := bytes.TrimLeft(rest, " \t")
+	if len(text) != 0 && text[0] == ':' {
+		// an action is expanded in place of the whitespace before it, which sets the
+		// indentation of the lines following it
+		lp.action = len(rest) - len(text)
+		l.Text = rest
+	} else if len(text) != 0 {
+		l.Space = len(text) != len(rest)
+		if text[0] == '/' {
+			text = bytes.TrimRight(text, " \t")
+		}
+		l.Text = text
+	}
+	return l, false
+}
+
+// chain returns the elements written from the start of toks, and the position in the
+// document following them.
+func (lp *lineParser) chain(toks []Token, end int) ([]*LineElem, int) {
+	b := lp.lex.bytes
+	var elems []*LineElem
+	var el *LineElem
+	for _, t := range toks {
+		switch t.typ {
+		case TokenElement:
+			// an inline element's token begins with the selector before it
+			if el != nil && bytes.IndexByte(b[end:t.end], '\n') != -1 {
+				return elems, end
+			}
+			el = new(LineElem)
+			elems = append(elems, el)
+		case TokenHashTag:
+			el.Tag = b[t.start:t.end]
+		case TokenHashId:
+			el.IDs = append(el.IDs, b[t.start:t.end])
+		case TokenHashClass:
+			el.Classes = append(el.Classes, b[t.start:t.end])
+		case TokenComment:
+			el.Comment = true
+		case TokenAttrKey:
+			if el == nil {
+				el = new(LineElem)
+				elems = append(elems, el)
+			}
+			key := b[t.start:t.end]
+			el.Attrs = append(el.Attrs, LineAttr{Key: key})
+			if t.end < len(b) && b[t.end] == ']' {
+				end = t.end + 1
+				continue
+			}
+		case TokenAttrValue:
+			a := &el.Attrs[len(el.Attrs)-1]
+			a.Value, a.HasValue = b[t.start:t.end], true
+			end = t.end + 1
+			continue
+		default:
+			return elems, end
+		}
+		end = t.end
+	}
+	return elems, end
+}
+
+// elem tracks the element of token t as DocParser nests it, returning the indentation it
+// is formatted at. An action at the start of a line is tracked as an element in place of
+// the lines it expands to.
+func (lp *lineParser) elem(t Token, lineStart bool) int {
+	lp.prevWs = lp.curWs
+	if lineStart {
+		lp.curWs = CountWs(t)
+	} else {
+		lp.curWs++
+	}
+	ws := lp.curWs
+	if ws != 0 && ws < lp.prevWs && (ws >= len(lp.cache) || lp.cache[ws] == nil) {
+		lp.errorf(t.end, "unindent does not match any outer indentation level")
+	}
+
+	el := &lineElem{ws: ws}
+	switch {
+	case ws == 0 || lp.cur == nil:
+		el.parent = lp.root
+	case ws > lp.prevWs:
+		el.parent = lp.cache[lp.prevWs]
+		if lineStart {
+			// lines are indented by whole tabs, each counted twice
+			el.f = el.parent.f/2*2 + 2
+		} else {
+			el.f = el.parent.f + 1
+		}
+	case ws == lp.prevWs:
+		el.parent, el.f = lp.cache[ws].parent, lp.cache[ws].f
+	default:
+		el.parent, el.f = lp.cache[ws].parent, lp.cache[ws].f
+	}
+	lp.cur = el
+
+	n := 0
+	if el.parent != lp.root {
+		n = el.parent.ws + 1
+	}
+	if n > len(lp.cache) {
+		n = len(lp.cache)
+	}
+	lp.cache = lp.cache[:n]
+	for len(lp.cache) < el.ws {
+		lp.cache = append(lp.cache, nil)
+	}
+	lp.cache = append(lp.cache, el)
+	return el.f
+}
+
+// textDepth returns the depth of a line of text indented by ws, as DocParser places it
+// relative to the current element. Unindented text is placed in the current element
+// whatever its depth, so it's kept unindented. A comment is placed as text would be,
+// though its indentation need not match any element.
+func (lp *lineParser) textDepth(ws, pos int, comment bool) int {
+	depth := 0
+	switch {
+	case lp.cur == nil || ws == 0:
+		lp.fixed = true
+		return 0
+	case ws > lp.curWs:
+		depth = lp.cur.f/2 + 1
+	case ws == lp.curWs:
+		depth = lp.cur.f / 2
+	case ws < len(lp.cache) && lp.cache[ws] != nil:
+		depth = lp.cache[ws].f / 2
+	case comment:
+		depth = lp.cur.f / 2
+	default:
+		lp.errorf(pos, "text indentation does not match any element")
+	}
+	lp.rootText = depth == 0 && !comment
+	return depth
+}
+
+// nest returns the lines nested by depth, each blank line taking the depth of the line
+// following it.
+func nest(lines []*Line) []*Line {
+	depth := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Kind == BlankLine {
+			lines[i].Depth = depth
+		} else {
+			depth = lines[i].Depth
+		}
+	}
+	var root []*Line
+	var stack []*Line
+	for _, l := range lines {
+		for len(stack) != 0 && stack[len(stack)-1].Depth >= l.Depth {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			root = append(root, l)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, l)
+		}
+		stack = append(stack, l)
+	}
+	return root
+}
+
+// WriteLines writes lines to w in canonical form, as described by Format.
+func WriteLines(w io.Writer, lines []*Line) error {
+	lw := &lineWriter{w: w}
+	lw.lines(lines)
+	return lw.err
+}
+
+type lineWriter struct {
+	w       io.Writer
+	buf     bytes.Buffer
+	written bool // whether a line other than a blank line has been written
+	blank   bool // whether a blank line is pending
+	err     error
+}
+
+func (lw *lineWriter) lines(lines []*Line) {
+	for _, l := range lines {
+		lw.line(l)
+		lw.lines(l.Children)
+	}
+}
+
+func (lw *lineWriter) line(l *Line) {
+	if l.Kind == BlankLine {
+		lw.blank = lw.written
+		return
+	}
+	b := &lw.buf
+	b.Reset()
+	if lw.blank {
+		b.WriteByte('\n')
+		lw.blank = false
+	}
+	lw.written = true
+	indent := bytes.Repeat([]byte{'\t'}, l.Depth)
+	b.Write(indent)
+	for i, el := range l.Elems {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		writeLineElem(b, el)
+	}
+	if l.Space && len(l.Elems) != 0 {
+		b.WriteByte(' ')
+	}
+	b.Write(l.Text)
+	b.WriteByte('\n')
+	for _, c := range l.Content {
+		if len(c) != 0 {
+			b.Write(indent)
+			b.Write(c)
+		}
+		b.WriteByte('\n')
+	}
+	if lw.err == nil {
+		_, lw.err = lw.w.Write(b.Bytes())
+	}
+}
+
+// writeLineElem writes el with its selectors ordered as %tag#id.class.
+func writeLineElem(b *bytes.Buffer, el *LineElem) {
+	if el.Comment {
+		b.WriteByte('!')
+	}
+	if el.Tag != nil {
+		b.WriteByte('%')
+		b.Write(el.Tag)
+	}
+	for _, id := range el.IDs {
+		b.WriteByte('#')
+		b.Write(id)
+	}
+	for _, c := range el.Classes {
+		b.WriteByte('.')
+		b.Write(c)
+	}
+	for _, a := range el.Attrs {
+		b.WriteByte('[')
+		b.Write(a.Key)
+		if a.HasValue {
+			b.WriteByte('=')
+			b.Write(unquote(a.Value))
+		}
+		b.WriteByte(']')
+	}
+}
+
+// unquote returns the attribute value v without quotes where they make no difference to
+// its value, as when they only enclose text that is itself unquoted.
+func unquote(v []byte) []byte {
+	if !isQuoted(v) {
+		return v
+	}
+	inner := v[1 : len(v)-1]
+	if isQuoted(inner) || len(inner) != 0 && inner[len(inner)-1] == '\\' {
+		return v
+	}
+	return inner
+}
+
+// isQuoted reports whether v is enclosed by a pair of single or double quotes, which are
+// removed from its value.
+func isQuoted(v []byte) bool {
+	return len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0]
+}
@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test_format(t *testing.T) {
+	tests := []struct {
+		src, expect string
+	}{
+		{"%html\n    %body\n        %p hi", "%html\n\t%body\n\t\t%p hi\n"},
+		{"\n\n%p\n\n\n\n  %a\n\n", "%p\n\n\t%a\n"},
+		{"%p.b#a[x=1]\n.c#d", "%p#a.b[x=1]\n#d.c\n"},
+		{`%a[href="/"][title='one two'][q=""][v="'x'"][e="a\"]`, `%a[href=/][title=one two][q=][v="'x'"][e="a\"]` + "\n"},
+		{"%p    several   spaces  ", "%p several   spaces  \n"},
+		{"!DOCTYPE html\n%html", "!DOCTYPE html\n%html\n"},
+		{"%p\n  / a comment   \n  \\ escaped", "%p\n\t/ a comment\n\t\\ escaped\n"},
+		{"%pre `one\n   two  \n three`", "%pre `one\n   two  \n three`\n"},
+		{"%html %head\n    :css /css/\n        main.css\n          extra.css\n\n    %title", "%html %head\n\t:css /css/\n\t    main.css\n\t      extra.css\n\n\t%title\n"},
+		{":extends base.dmsl\n\n#content\n  %p", ":extends base.dmsl\n\n#content\n\t%p\n"},
+		{"#bar[a=1]\n      [c=3]\n  %p", "#bar[a=1]\n\t[c=3]\n\t%p\n"},
+		{"%a %b %c\n  %d", "%a %b %c\n\t\t%d\n"},
+		{"%a %b %c\n\t%d", "%a %b %c\n\t%d\n"},
+		{"%ul\n  {range .}\n  %li {.}\n  {end}", "%ul\n\t{range .}\n\t%li {.}\n\t{end}\n"},
+		{"%p\n  != <b>raw</b>", "%p\n\t!= <b>raw</b>\n"},
+		{"  #a\n  != r[x=1]", "\t#a\n\t!= r[x=1]\n"},
+		{"%p\n  !\n  .c x", "%p\n\t!\n\t.c x\n"},
+		{"#a[super]:js x\n[keep]", "#a[super]:js x\n[keep]\n"},
+		{"%p\n  #a   :js x\n  [keep]", "%p\n\t#a   :js x\n\t\t[keep]\n"},
+	}
+	for _, tt := range tests {
+		r, err := Format([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.src, err)
+		}
+		if string(r) != tt.expect {
+			t.Fatalf("%q\nexpected %q\nreceived %q", tt.src, tt.expect, r)
+		}
+	}
+}
+
+// Test_format_document checks formatting is idempotent and leaves the document a source
+// parses to unchanged, with and without template actions.
+func Test_format_document(t *testing.T) {
+	files, err := filepath.Glob("../tests/*.dmsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcs := []string{
+		"%html\n  %body\n      %p one\n      %p two\n  %footer",
+		"%p This is\n    multiline\n    \\ text\n  %span x\n    \\ y\n  \\ tail",
+		"%a %b %c\n  %d\n  text\n%e",
+		"%a %b %c\n\t%d\n\ttext\n%e",
+		"%div\n\t%p\n\t\t%a\n\t  \\ t\n\t%i",
+		"%p `a\n b` %b\n  %i",
+		"%html %head\n  :css /css/\n    a.css\n  %title\n",
+		"#foo\n  [a=\"1\"]\n  [b='2]'\n  %p x\n  [c=3] y",
+		"! %ul\n  %li 1\n![if IE] %p ie\n%html",
+		"%p\n  / comment\n      / deep comment\n  %a",
+		"  #a\n  != r[x=1]",
+		"%p\n  !\n  .c x",
+		"#a[super]:js x\n[keep]",
+		"\t%br\n\t!=:js x",
+		"  #a\n!= t\n    %b\n  != r\n%c",
+		"%p\n  :js x\n[keep]\n  %b",
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, string(b))
+	}
+	for _, src := range srcs {
+		r, err := Format([]byte(src))
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		r2, err := Format(r)
+		if err != nil {
+			t.Fatalf("%q: %v", r, err)
+		}
+		if string(r2) != string(r) {
+			t.Fatalf("%q: not idempotent\nfirst  %q\nsecond %q", src, r, r2)
+		}
+		for _, delims := range []bool{false, true} {
+			parse := func(src []byte) (string, error) {
+				p := NewDocParser("")
+				p.Mode = Fragment
+				if delims {
+					p.Delims("{", "}")
+				}
+				return p.Parse(src)
+			}
+			expect, err := parse([]byte(src))
+			r, ferr := parse(r)
+			if (err == nil) != (ferr == nil) || r != expect {
+				t.Fatalf("%q: formatted document differs\nexpected %s %v\nreceived %s %v", src, expect, err, r, ferr)
+			}
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package parse
 
+import (
+	"bytes"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
 const eof = -1
 
 type TokenType int
@@ -13,6 +20,7 @@ const (
 	TokenAttrValue
 	TokenText
 	TokenTextWs
+	TokenTextRaw
 	TokenComment
 	TokenActionStart
 	TokenActionName
@@ -38,6 +46,7 @@ var TokenString = map[TokenType]string{
 	TokenAttrValue:       "AttrValue",
 	TokenText:            "Text",
 	TokenTextWs:          "TextWs",
+	TokenTextRaw:         "TextRaw",
 	TokenComment:         "Comment",
 	TokenActionStart:     "ActionStart",
 	TokenActionName:      "ActionName",
@@ -55,12 +64,15 @@ type TokenReceiver interface {
 type stateFn func(*lexer) stateFn
 
 type lexer struct {
+	name     string
 	bytes    []byte
 	state    stateFn
 	pos      int
 	start    int
 	ident    int
 	receiver TokenReceiver
+	err      *Error
+	origins  []Origin // origin of each line of bytes, if not the named document
 }
 
 func NewLexer(receiver TokenReceiver) *lexer {
@@ -71,35 +83,103 @@ func NewLexer(receiver TokenReceiver) *lexer {
 }
 
 func (l *lexer) Run() {
+	l.bytes = normalize(l.bytes)
 	for l.state != nil {
 		l.state = l.state(l)
 	}
 }
 
+// normalize returns b without a leading utf-8 byte order mark and with each \r\n or lone
+// \r line ending replaced by \n. b is only copied if a line ending is replaced.
+func normalize(b []byte) []byte {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	i := bytes.IndexByte(b, '\r')
+	if i == -1 {
+		return b
+	}
+	r := make([]byte, i, len(b))
+	copy(r, b)
+	for ; i < len(b); i++ {
+		if b[i] != '\r' {
+			r = append(r, b[i])
+		} else if i+1 == len(b) || b[i+1] != '\n' {
+			r = append(r, '\n')
+		}
+	}
+	return r
+}
+
 func (l *lexer) emit(t TokenType) {
 	l.receiver.ReceiveToken(Token{typ: t, start: l.start, end: l.pos})
 }
 
+// next advances past the current rune.
 func (l *lexer) next() {
-	l.pos++
+	if l.pos < len(l.bytes) && l.bytes[l.pos] < utf8.RuneSelf {
+		l.pos++
+		return
+	}
+	l.nextMultibyte()
+}
+
+// nextMultibyte is kept apart from next so ascii input stays on a short, inlined path.
+func (l *lexer) nextMultibyte() {
+	if l.pos < len(l.bytes) {
+		_, w := utf8.DecodeRune(l.bytes[l.pos:])
+		l.pos += w
+	}
 }
 
 func (l *lexer) reset() {
 	l.start = l.pos
 }
 
+// rune returns the current rune, decoded as utf-8, or eof.
 func (l *lexer) rune() rune {
+	if l.pos < len(l.bytes) && l.bytes[l.pos] < utf8.RuneSelf {
+		return rune(l.bytes[l.pos])
+	}
+	return l.runeMultibyte()
+}
+
+// runeMultibyte is kept apart from rune so ascii input stays on a short path.
+func (l *lexer) runeMultibyte() rune {
 	if l.pos >= len(l.bytes) {
 		return eof
 	}
-	return rune(l.bytes[l.pos])
+	r, _ := utf8.DecodeRune(l.bytes[l.pos:])
+	return r
 }
 
 func (l *lexer) discard() {
-	l.pos++
+	l.next()
 	l.start = l.pos
 }
 
+// errorAt returns an *Error for err located at pos of the current input.
+func (l *lexer) errorAt(pos int, err error) *Error {
+	e := newError(l.name, l.bytes, pos, err)
+	if i := e.Line - 1; i < len(l.origins) {
+		o := l.origins[i]
+		e.Name, e.Line = o.Name, o.Line
+		// the column and snippet are those of the line as written, without the
+		// indentation an action added to it
+		if n := o.indent; n != 0 && n <= len(e.Snippet) {
+			e.Snippet = e.Snippet[n:]
+			if e.Col -= n; e.Col < 1 {
+				e.Col = 1
+			}
+		}
+	}
+	return e
+}
+
+// errorf records an error at the start of the current token and halts the lexer.
+func (l *lexer) errorf(format string, args ...interface{}) stateFn {
+	l.err = l.errorAt(l.start, fmt.Errorf(format, args...))
+	return nil
+}
+
 func (l *lexer) saveIdent() {
 	// TODO error if l.ident != -1
 	l.ident = (l.pos - l.start) * 2
@@ -131,7 +211,16 @@ func lexWhiteSpace(l *lexer) stateFn {
 			l.emit(TokenActionStart)
 			l.discard()
 			return lexAction
-		case '%', '#', '.', '!':
+		case '!':
+			if l.pos+1 < len(l.bytes) && l.bytes[l.pos+1] == '=' {
+				l.emit(TokenTextWs)
+				l.pos += 2
+				l.reset()
+				return lexTextRaw
+			}
+			l.emit(TokenElement)
+			return lexHash
+		case '%', '#', '.':
 			l.emit(TokenElement)
 			return lexHash
 		case eof:
@@ -151,8 +240,6 @@ func lexWhiteSpace(l *lexer) stateFn {
 			return lexText
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexComment(l *lexer) stateFn {
@@ -167,8 +254,6 @@ func lexComment(l *lexer) stateFn {
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexHash(l *lexer) stateFn {
@@ -193,8 +278,6 @@ func lexHash(l *lexer) stateFn {
 			return lexWhiteSpace
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexHashTag(l *lexer) stateFn {
@@ -207,8 +290,52 @@ func lexHashTag(l *lexer) stateFn {
 			l.next()
 		}
 	}
+}
+
+// isTagName reports whether b is a valid html tag name: an ascii letter followed by ascii
+// letters, digits and hyphens, or the other characters allowed in custom element names.
+// Colons are allowed for namespace prefixes, such as svg:rect.
+func isTagName(b []byte) bool {
+	if len(b) == 0 || !('a' <= b[0] && b[0] <= 'z' || 'A' <= b[0] && b[0] <= 'Z') {
+		return false
+	}
+	for i := 1; i < len(b); {
+		r, w := utf8.DecodeRune(b[i:])
+		switch {
+		case r == utf8.RuneError && w == 1:
+			return false
+		case r < utf8.RuneSelf:
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_' || r == ':') {
+				return false
+			}
+		case !unicode.Is(pcenChars, r):
+			return false
+		}
+		i += w
+	}
+	return true
+}
 
-	panic("unreachable")
+// pcenChars are the non-ascii characters allowed in custom element names.
+var pcenChars = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00b7, 0x00b7, 1},
+		{0x00c0, 0x00d6, 1},
+		{0x00d8, 0x00f6, 1},
+		{0x00f8, 0x037d, 1},
+		{0x037f, 0x1fff, 1},
+		{0x200c, 0x200d, 1},
+		{0x203f, 0x2040, 1},
+		{0x2070, 0x218f, 1},
+		{0x2c00, 0x2fef, 1},
+		{0x3001, 0xd7ff, 1},
+		{0xf900, 0xfdcf, 1},
+		{0xfdf0, 0xfffd, 1},
+	},
+	R32: []unicode.Range32{
+		{0x10000, 0xeffff, 1},
+	},
+	LatinOffset: 3,
 }
 
 func lexHashId(l *lexer) stateFn {
@@ -221,8 +348,6 @@ func lexHashId(l *lexer) stateFn {
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexHashClass(l *lexer) stateFn {
@@ -235,8 +360,43 @@ func lexHashClass(l *lexer) stateFn {
 			l.next()
 		}
 	}
+}
+
+// IsIdent reports whether s can be written as an #id or .class.
+func IsIdent(s string) bool {
+	return isIdent([]byte(s))
+}
 
-	panic("unreachable")
+// isIdent reports whether b is a css identifier, so that an id or class can be selected
+// without escaping: ascii letters, digits, hyphens, underscores and non-ascii characters,
+// not starting with a digit, or with a hyphen followed by a digit.
+func isIdent(b []byte) bool {
+	name := b
+	if len(name) > 0 && name[0] == '-' {
+		name = name[1:]
+		if len(name) > 0 && name[0] == '-' {
+			name = name[1:]
+			if len(name) == 0 {
+				return true
+			}
+		}
+	}
+	if len(name) == 0 || '0' <= name[0] && name[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(b); {
+		r, w := utf8.DecodeRune(b[i:])
+		switch {
+		case r == utf8.RuneError && w == 1:
+			return false
+		case r < utf8.RuneSelf:
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+		i += w
+	}
+	return true
 }
 
 func lexAttributeKey(l *lexer) stateFn {
@@ -251,13 +411,11 @@ func lexAttributeKey(l *lexer) stateFn {
 			l.discard()
 			return lexWhiteSpace
 		case eof:
-			return nil // TODO emit error
+			return l.errorf("unterminated attribute")
 		default:
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexAttributeValue(l *lexer) stateFn {
@@ -273,13 +431,11 @@ func lexAttributeValue(l *lexer) stateFn {
 			l.discard()
 			return lexWhiteSpace
 		case eof:
-			return nil // TODO handle error
+			return l.errorf("unterminated attribute value")
 		default:
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexTextEscape(l *lexer) stateFn {
@@ -289,12 +445,13 @@ func lexTextEscape(l *lexer) stateFn {
 			l.emit(TokenText)
 			l.discard()
 			return lexWhiteSpace
+		case eof:
+			l.start-- // report the opening backtick
+			return l.errorf("unterminated text escape")
 		default:
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexText(l *lexer) stateFn {
@@ -311,8 +468,26 @@ func lexText(l *lexer) stateFn {
 			l.next()
 		}
 	}
+}
 
-	panic("unreachable")
+// lexTextRaw lexes text following != that is to be written without escaping.
+func lexTextRaw(l *lexer) stateFn {
+	for l.rune() == ' ' || l.rune() == '\t' {
+		l.discard()
+	}
+	for {
+		switch l.rune() {
+		case '\n':
+			l.emit(TokenTextRaw)
+			l.discard()
+			return lexWhiteSpace
+		case eof:
+			l.emit(TokenTextRaw)
+			return nil
+		default:
+			l.next()
+		}
+	}
 }
 
 // lexAction stands alone for parsing, not mingling with lexWhiteSpace until
@@ -329,13 +504,14 @@ func lexAction(l *lexer) stateFn {
 			l.discard()
 			return lexActionWhiteSpace
 		case eof:
-			return nil
+			// an action on the last line ends with the input
+			l.emit(TokenActionName)
+			l.reset()
+			return lexActionWhiteSpace
 		default:
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexActionArgs(l *lexer) stateFn {
@@ -346,13 +522,13 @@ func lexActionArgs(l *lexer) stateFn {
 			l.discard()
 			return lexActionWhiteSpace
 		case eof:
-			return nil
+			l.emit(TokenActionArgs)
+			l.reset()
+			return lexActionWhiteSpace
 		default:
 			l.next()
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexActionWhiteSpace(l *lexer) stateFn {
@@ -376,8 +552,6 @@ func lexActionWhiteSpace(l *lexer) stateFn {
 			return lexActionContent
 		}
 	}
-
-	panic("unreachable")
 }
 
 func lexActionContent(l *lexer) stateFn {
@@ -387,11 +561,13 @@ func lexActionContent(l *lexer) stateFn {
 			l.emit(TokenActionContent)
 			l.discard()
 			return lexActionWhiteSpace
+		case eof:
+			l.emit(TokenActionContent)
+			l.reset()
+			return lexActionWhiteSpace
 		default:
 			l.next()
 			break
 		}
 	}
-
-	panic("unreachable")
 }
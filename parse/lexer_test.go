@@ -3,6 +3,7 @@ package parse
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +42,63 @@ func Test_lexer1(t *testing.T) {
 	l.Run()
 }
 
+// TokenCollector records each token as its type and text.
+type TokenCollector struct {
+	l      *lexer
+	tokens []string
+}
+
+func (t *TokenCollector) ReceiveToken(tkn Token) {
+	t.tokens = append(t.tokens, TokenString[tkn.typ]+" "+string(t.l.bytes[tkn.start:tkn.end]))
+}
+
+func lex(s string) []string {
+	c := new(TokenCollector)
+	c.l = NewLexer(c)
+	c.l.bytes = []byte(s)
+	c.l.Run()
+	return c.tokens
+}
+
+func Test_lexer_line_endings(t *testing.T) {
+	s := "%html\n\t%head\n\t\t:include foo.dmsl\n\t%body[a=1]\n\t\t%p Hello\n\t\t\\ World\n\t\t:css /css/\n\t\t\tmain.css\n"
+	expect := strings.Join(lex(s), "\n")
+	tests := map[string]string{
+		"crlf":     strings.Replace(s, "\n", "\r\n", -1),
+		"cr":       strings.Replace(s, "\n", "\r", -1),
+		"bom":      "\xef\xbb\xbf" + s,
+		"bom crlf": "\xef\xbb\xbf" + strings.Replace(s, "\n", "\r\n", -1),
+	}
+	for name, src := range tests {
+		if r := strings.Join(lex(src), "\n"); r != expect {
+			t.Fatalf("%s: expected\n%s\nreceived\n%s", name, expect, r)
+		}
+	}
+
+	var args string
+	p := NewActionParser("").Funcs(FuncMap{
+		"include": func(a *Action) ([]byte, error) {
+			args = string(a.Args)
+			return nil, nil
+		},
+		"css": func(a *Action) ([]byte, error) { return nil, nil },
+	})
+	if _, err := p.Parse([]byte(tests["bom crlf"])); err != nil {
+		t.Fatal(err)
+	}
+	if args != "foo.dmsl" {
+		t.Fatalf("unexpected args %q", args)
+	}
+
+	r, err := NewDocParser("").Parse([]byte("\xef\xbb\xbf%p\r\n  %span One\r\n  \\ Two\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "<p><span>One</span> Two</p>"; r != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, r)
+	}
+}
+
 func Benchmark_bigtable2(b *testing.B) {
 	b.StopTimer()
 	bytes, err := ioutil.ReadFile("../../tests/bigtable2.dmsl")
@@ -0,0 +1,213 @@
+package parse
+
+import "bytes"
+
+// Root elements following the first of a document, or the doctype and first, override
+// the element of the document with the same id. By default, the children of the override
+// replace those of the element, as does its text unless it has none. One of the following
+// attributes on the override selects another behavior and is removed from the result.
+//
+//	super, append  add the text and children after the content of the element
+//	prepend        add the text and children before the content of the element
+//	before         insert the text and children as siblings before the element
+//	after          insert the text and children as siblings after the element
+//	replace        replace the element itself with the override
+//	remove         remove the element, keeping the text after it
+//
+// Unless replacing or removing the element, the override's classes are added to those of
+// the element, its attributes replace those of the element, and its tag replaces the
+// element's if given explicitly. A keep attribute on the override keeps the element's value
+// of the attributes it names, or of all attributes if it has no value.
+//
+// An override without a matching element applies any overrides it holds instead.
+var overrideAttrs = []string{"super", "append", "prepend", "before", "after", "replace", "remove"}
+
+// override applies o to the first element of doc with the same id.
+func (p *DocParser) override(doc []*Elem, o *Elem) {
+	if o.typ == ElementNode && o.id != nil {
+		if target := findID(doc, o.id); target != nil {
+			p.apply(target, o)
+			return
+		}
+	}
+	for _, child := range o.children {
+		p.override(doc, child)
+	}
+}
+
+// findID returns the first element of elems, or held by them, with the given id.
+func findID(elems []*Elem, id []byte) *Elem {
+	for _, el := range elems {
+		if el.typ == ElementNode && bytes.Equal(el.id, id) {
+			return el
+		}
+		if found := findID(el.children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// overrideOp removes the reserved attribute of o selecting its behavior and returns it,
+// or "" if it has none.
+func (p *DocParser) overrideOp(o *Elem) string {
+	op := ""
+	attr := o.attr[:0]
+	for _, v := range o.attr {
+		if !isOverrideAttr(v[0]) {
+			attr = append(attr, v)
+			continue
+		}
+		if op != "" && op != string(v[0]) {
+			p.errorf(o.pos, "override #%s can not both %s and %s", o.id, op, v[0])
+		}
+		op = string(v[0])
+	}
+	o.attr = attr
+	return op
+}
+
+func isOverrideAttr(key []byte) bool {
+	for _, k := range overrideAttrs {
+		if string(key) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// apply modifies target, an element of the document, as given by the override o.
+func (p *DocParser) apply(target, o *Elem) {
+	op := p.overrideOp(o)
+	keep, keepAll := keepAttrs(o)
+	parent := target.parent
+	switch op {
+	case "before", "after", "replace", "remove":
+		if parent == p.root {
+			p.errorf(o.pos, "override #%s can not %s the root element", o.id, op)
+		}
+	}
+
+	switch op {
+	case "replace", "remove":
+	default:
+		p.merge(target, o, keep, keepAll)
+	}
+
+	switch op {
+	case "":
+		if len(o.text) > 0 {
+			target.text = o.text
+		}
+		target.children = adopt(target, o.children)
+	case "super", "append":
+		target.insertContent(len(target.children), o.text, o.children)
+	case "prepend":
+		// the text of the element follows that of the override and its children
+		children := adopt(target, o.children)
+		if n := len(children); n != 0 {
+			children[n-1].tail = append(children[n-1].tail, target.text...)
+			target.text = o.text
+		} else {
+			target.text = append(o.text[:len(o.text):len(o.text)], target.text...)
+		}
+		target.children = append(children, target.children...)
+	case "before":
+		parent.insertContent(target.index0(), o.text, o.children)
+	case "after":
+		parent.insertContent(target.index0()+1, o.text, o.children)
+	case "replace":
+		o.parent, o.tail = parent, target.tail
+		parent.children[target.index0()] = o
+		target.parent = nil
+	case "remove":
+		target.Remove()
+	}
+}
+
+// merge adds the tag, classes and attributes of o to target, keeping the value of target's
+// attributes named by keep, or of all its attributes if keepAll.
+func (p *DocParser) merge(target, o *Elem, keep [][]byte, keepAll bool) {
+	if o.hasTag {
+		target.tag, target.hasTag = o.tag, true
+	}
+	for _, c := range o.class {
+		if !contains(target.class, c) {
+			target.class = append(target.class, c)
+		}
+	}
+	for _, v := range o.attr {
+		i := target.attrIndex(v[0])
+		switch {
+		case i == -1:
+			target.attr = append(target.attr, [][]byte{v[0], v[1]})
+		case !keepAll && !contains(keep, v[0]):
+			target.attr[i] = [][]byte{v[0], v[1]}
+		}
+	}
+}
+
+// keepAttrs removes the keep attribute of o, whatever its behavior, returning the attribute
+// names it lists or true if it lists none.
+func keepAttrs(o *Elem) ([][]byte, bool) {
+	i := o.attrIndex([]byte("keep"))
+	if i == -1 {
+		return nil, false
+	}
+	keep := bytes.Fields(o.attr[i][1])
+	o.attr = append(o.attr[:i:i], o.attr[i+1:]...)
+	return keep, len(keep) == 0
+}
+
+// attrIndex returns the index of the attribute key in the attributes of el, or -1.
+func (el *Elem) attrIndex(key []byte) int {
+	for i, v := range el.attr {
+		if bytes.Equal(v[0], key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// adopt sets the parent of each of elems to parent, returning elems.
+func adopt(parent *Elem, elems []*Elem) []*Elem {
+	for _, el := range elems {
+		el.parent = parent
+	}
+	return elems
+}
+
+// insert inserts elems into the children of el at index i.
+func (el *Elem) insert(i int, elems []*Elem) {
+	children := make([]*Elem, 0, len(el.children)+len(elems))
+	children = append(children, el.children[:i]...)
+	children = append(children, elems...)
+	el.children = append(children, el.children[i:]...)
+}
+
+// insertContent inserts text followed by elems into the content of el, before the child
+// at index i and after the text preceding it.
+func (el *Elem) insertContent(i int, text []chunk, elems []*Elem) {
+	t := el.textBefore(i)
+	*t = append(*t, text...)
+	el.insert(i, adopt(el, elems))
+}
+
+// textBefore returns the text preceding the child of el at index i, the tail of the child
+// before it or the text of el.
+func (el *Elem) textBefore(i int) *[]chunk {
+	if i > 0 {
+		return &el.children[i-1].tail
+	}
+	return &el.text
+}
+
+// index0 returns the 0-based position of el among all the children of its parent.
+func (el *Elem) index0() int {
+	for i, c := range el.parent.children {
+		if c == el {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,7 +1,10 @@
 package parse
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"strings"
 )
 
 // CountWs is only called for appropriate emitted tokens that are known to be
@@ -11,80 +14,186 @@ func CountWs(t Token) int {
 	return (t.end - t.start) * 2
 }
 
+// ActionError reports an action that is unknown or that failed while being evaluated.
 type ActionError struct {
-	Value string
+	Value string // name of the action
+	Err   error  // error returned by the action, nil if unknown
 }
 
 func (e *ActionError) Error() string {
-	return fmt.Sprintf("damsel: action \"%s\" unknown.", e.Value)
+	if e.Err == nil {
+		return fmt.Sprintf("action %q unknown", e.Value)
+	}
+	return fmt.Sprintf("action %q: %v", e.Value, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
 }
 
 type Action struct {
 	name       []byte
 	start      int
+	pos        int
 	contentWs  int
 	Args       []byte
 	Content    [][]byte
-	whitespace int
+	whitespace string
+	origins    []Origin
 }
 
-func (a *Action) Whitespace() string {
-	ws := ""
-	for i := 0; i < a.whitespace/2; i++ {
-		ws += "\t"
+// SetOrigins gives the origin of each line of the action's result, such as for lines
+// read from another file. Lines without an origin are attributed to the action.
+func (a *Action) SetOrigins(origins []Origin) {
+	a.origins = origins
+}
+
+// IndentOrigins records that each line of the action's result is indented by its
+// Whitespace past the line of its origin, as by include, so errors in the line are
+// located in the line as written. It's called after SetOrigins.
+func (a *Action) IndentOrigins() {
+	for i := range a.origins {
+		a.origins[i].indent += len(a.whitespace)
 	}
-	return ws
 }
 
-type ActionFn func(*Action) string
+// Whitespace returns the indentation of the line holding the action, for indenting lines
+// of its result to match.
+func (a *Action) Whitespace() string {
+	return a.whitespace
+}
+
+// ActionFn evaluates an action and returns content to be lexed in its place.
+type ActionFn func(*Action) ([]byte, error)
 
 type FuncMap map[string]ActionFn
 
-var DefaultFuncMap = map[string]ActionFn{}
+// DefaultFuncMap holds the actions used by ActionParse and by parsers not given
+// their own with Funcs.
+var DefaultFuncMap = FuncMap{}
 
 type ActionParser struct {
+	name    string
 	lex     *lexer
 	action  *Action
 	funcMap FuncMap
+	origins []Origin // origin of each line, once an action is spliced in
 }
 
+// ActionParse evaluates all actions in bytes using DefaultFuncMap.
 func ActionParse(bytes []byte) ([]byte, error) {
+	return NewActionParser("").Parse(bytes)
+}
+
+// NewActionParser returns a parser for evaluating actions of the named document.
+func NewActionParser(name string) *ActionParser {
 	p := new(ActionParser)
+	p.name = name
 	p.funcMap = DefaultFuncMap
+	return p
+}
+
+// Funcs sets the actions available to the parser, replacing DefaultFuncMap.
+func (p *ActionParser) Funcs(funcMap FuncMap) *ActionParser {
+	p.funcMap = funcMap
+	return p
+}
+
+// Parse evaluates all actions in bytes and returns the resulting document. A returned
+// error will be of type *Error.
+func (p *ActionParser) Parse(bytes []byte) (result []byte, err error) {
+	defer recoverError(&err)
+	p.origins = nil
 	p.lex = NewLexer(p)
+	p.lex.name = p.name
 	p.lex.bytes = bytes
 	p.lex.Run()
-	// TODO real errors
+	if p.lex.err != nil {
+		return nil, p.lex.err
+	}
 	return p.lex.bytes, nil
 }
 
+// Origins returns the file and line each line of the last result came from.
+func (p *ActionParser) Origins() []Origin {
+	if p.origins == nil && p.lex != nil {
+		p.origins = origins(p.name, p.lex.bytes)
+	}
+	return p.origins
+}
+
+// recoverError is deferred by parsers to turn a panicking *Error into a returned error.
+func recoverError(errp *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*errp = e
+	}
+}
+
 func (p *ActionParser) handleActionEnd(t Token) {
 	name := string(p.action.name)
 
 	if p.funcMap[name] == nil {
-		panic(&ActionError{name})
+		panic(p.lex.errorAt(p.action.pos, &ActionError{Value: name}))
+	}
+	b, err := p.funcMap[name](p.action)
+	if err != nil {
+		panic(p.lex.errorAt(p.action.pos, &ActionError{Value: name, Err: err}))
 	}
-	// TODO actionFn should return possible error
-	result := p.funcMap[name](p.action)
 
-	// TODO just use []byte
-	b := []byte(result)
+	// resume with the line break that ended the action, absent only at eof
+	end := t.start
+	if end > 0 && p.lex.bytes[end-1] == '\n' {
+		end--
+	}
+
+	p.spliceOrigins(end, b)
 
-	// need to evaluate actionFn result against normal lexing
-	p.lex.bytes = append(p.lex.bytes[:p.action.start], append(b, p.lex.bytes[t.start-1:]...)...)
+	// need to evaluate actionFn result against normal lexing; a new buffer is allocated
+	// so neither the source given to Parse nor the result of the action is modified
+	rest := p.lex.bytes[end:]
+	buf := make([]byte, 0, p.action.start+len(b)+len(rest))
+	buf = append(buf, p.lex.bytes[:p.action.start]...)
+	buf = append(buf, b...)
+	p.lex.bytes = append(buf, rest...)
 
 	// reset pos and start to delete/insert point for lexer
 	p.lex.pos = p.action.start
 	p.lex.start = p.action.start
 }
 
+// spliceOrigins updates the origin of each line for the result b of the current action
+// replacing the input up to end.
+func (p *ActionParser) spliceOrigins(end int, b []byte) {
+	o := p.Origins()
+	first := bytes.Count(p.lex.bytes[:p.action.start], []byte{'\n'})
+	last := first + bytes.Count(p.lex.bytes[p.action.start:end], []byte{'\n'})
+	n := bytes.Count(b, []byte{'\n'}) + 1
+
+	spliced := make([]Origin, 0, len(o)-(last-first+1)+n)
+	spliced = append(spliced, o[:first]...)
+	for i := 0; i < n; i++ {
+		if i < len(p.action.origins) {
+			spliced = append(spliced, p.action.origins[i])
+		} else {
+			spliced = append(spliced, o[first])
+		}
+	}
+	p.origins = append(spliced, o[last+1:]...)
+	p.lex.origins = p.origins
+}
+
 func (p *ActionParser) ReceiveToken(t Token) {
 	switch t.typ {
 	case TokenActionStart:
-		p.action = &Action{start: t.start, whitespace: CountWs(t)}
+		p.action = &Action{start: t.start, whitespace: string(p.lex.bytes[t.start:t.end])}
 		break
 	case TokenActionName:
 		p.action.name = p.lex.bytes[t.start:t.end]
+		p.action.pos = t.start - 1
 		break
 	case TokenActionArgs:
 		p.action.Args = p.lex.bytes[t.start:t.end]
@@ -109,70 +218,190 @@ func (p *ActionParser) ReceiveToken(t Token) {
 	}
 }
 
+// Mode holds options for parsing and writing documents.
+type Mode uint
+
+const (
+	// NoEscape writes text and attribute values as is, such as for a document produced by
+	// html/template that has already been escaped.
+	NoEscape Mode = 1 << iota
+
+	// XHTML writes void elements as self-closing, such as <br />.
+	XHTML
+
+	// SourceComments writes a comment before each element giving the file and line it
+	// was parsed from, such as <!-- index.dmsl:4 -->.
+	SourceComments
+
+	// Fragment writes every root element of the source, such as for a partial document,
+	// rather than the first root element only. Overrides don't apply to fragments.
+	Fragment
+
+	// StrictIndent rejects indentation whose nesting depends on the width of a tab, such
+	// as a line indented with spaces beneath a line indented with a tab.
+	StrictIndent
+)
+
 type DocParser struct {
+	Mode Mode
+
+	name    string
 	lex     *lexer
 	root    *Elem
 	curElem *Elem
 	prevWs  int
 	curWs   int
 	textWs  int
-	ids     map[string][]*Elem
 	cache   []*Elem
 	action  []byte
+
+	origins []Origin
+	smap    *SourceMap
+
+	// template actions, see Delims
+	leftDelim  []byte
+	rightDelim []byte
+	textLine   bool
+	blocks     []*block
+	pending    [][]byte
+	last       mark
+	sealed     map[*Elem]bool
+}
+
+// DocParse parses bytes as a damsel document and returns the html result.
+func DocParse(bytes []byte) (string, error) {
+	return NewDocParser("").Parse(bytes)
 }
 
-func DocParse(bytes []byte) (result string, err error) {
+// NewDocParser returns a parser for the named document.
+func NewDocParser(name string) *DocParser {
 	p := new(DocParser)
-	p.root = new(Elem)
-	p.root.tag = []byte("root")
-	p.ids = make(map[string][]*Elem)
+	p.name = name
+	return p
+}
 
-	p.lex = NewLexer(p)
-	p.lex.bytes = bytes
+// Parse parses src as a damsel document and returns the html result. A returned
+// error will be of type *Error.
+func (p *DocParser) Parse(src []byte) (string, error) {
+	var b strings.Builder
+	if err := p.Render(&b, src); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
 
-	/*
-		defer func() {
-			if r := recover(); r != nil {
-				err = r.(error)
-			}
-		}()
-	*/
+// Render parses src as a damsel document and writes the html result to w. Parse errors
+// are of type *Error and are returned before anything is written.
+func (p *DocParser) Render(w io.Writer, src []byte) error {
+	elems, err := p.parse(src)
+	if err != nil {
+		return err
+	}
+	_, err = render(w, elems, p.printer())
+	return err
+}
 
-	p.lex.Run()
+// Origins sets the origin of each line of the source given to Parse, such as returned by
+// ActionParser.Origins, for locating errors and elements.
+func (p *DocParser) Origins(origins []Origin) *DocParser {
+	p.origins = origins
+	return p
+}
 
-	// combine #ids
-	for _, elems := range p.ids {
-		if len(elems) > 1 {
-			for i := 1; i < len(elems); i++ {
+// SourceMap sets m to record the origin of each element written by Render or Parse.
+func (p *DocParser) SourceMap(m *SourceMap) *DocParser {
+	p.smap = m
+	return p
+}
 
-				isSuper := false
+func (p *DocParser) printer() printer {
+	pr := printer{pprint: Pprint, mode: p.Mode, leftDelim: p.leftDelim, rightDelim: p.rightDelim}
+	if p.Mode&SourceComments != 0 || p.smap != nil {
+		pr.src = &sourceInfo{
+			lines:    newLineTable(p.name, p.lex.bytes, p.origins),
+			comments: p.Mode&SourceComments != 0,
+			smap:     p.smap,
+		}
+	}
+	return pr
+}
 
-				// check for [super] attr
-				for k, v := range elems[i].attr {
-					if string(v[0]) == "super" {
-						isSuper = true
-						elems[i].attr = append(elems[i].attr[:k], elems[i].attr[k+1:]...)
-						break
-					}
-				}
+// parse parses src and returns the elements of the document to be written.
+func (p *DocParser) parse(src []byte) (elems []*Elem, err error) {
+	defer recoverError(&err)
 
-				if isSuper {
-					elems[0].children = append(elems[0].children, elems[i].children...)
-				} else {
-					elems[0].children = elems[i].children
-				}
+	p.root = &Elem{typ: DocumentNode}
+	p.curElem = nil
+	p.prevWs, p.curWs, p.textWs = 0, 0, 0
+	p.cache = nil
+	p.blocks, p.pending, p.last = nil, nil, mark{}
+	p.sealed = make(map[*Elem]bool)
+	p.lex = NewLexer(p)
+	p.lex.name = p.name
+	p.lex.bytes = src
+	p.lex.origins = p.origins
+	p.lex.Run()
+	if p.lex.err != nil {
+		return nil, p.lex.err
+	}
+	if p.leftDelim != nil {
+		p.closeDirectives()
+	}
+
+	children := p.root.children
+	n := len(children)
+	if p.Mode&Fragment == 0 {
+		// the document is its first element and any doctype and comments leading it
+		for n = 0; n < len(children) && children[n].typ != ElementNode; n++ {
+		}
+		if n == len(children) {
+			p.errorf(len(p.lex.bytes), "document has no root element")
+		}
+		n++
+	}
+	// root elements past the document only serve to override it
+	for _, o := range children[n:] {
+		p.override(children[:n], o)
+	}
+	p.root.children = dropDoctypes(children[:n:n])
+	return p.root.children, nil
+}
+
+// dropDoctypes removes all but the first doctype of elems, such as when a document and
+// the layout it extends each declare one.
+func dropDoctypes(elems []*Elem) []*Elem {
+	r := elems[:0]
+	seen := false
+	for _, el := range elems {
+		if el.typ == DoctypeNode {
+			if seen {
+				continue
 			}
+			seen = true
 		}
+		r = append(r, el)
 	}
+	return r
+}
 
-	// BUG(d) DOCTYPE check is horrid and could potentially result in panic for non-conformant or bug-ridden dmsl docs.
-	if p.root.children[0].isComment {
-		result = p.root.children[0].String()
-		result += p.root.children[1].String()
-	} else {
-		result = p.root.children[0].String()
+// ParseTree parses src as a damsel document and returns its tree, rooted at a DocumentNode.
+func ParseTree(src []byte) (*Elem, error) {
+	return NewDocParser("").ParseTree(src)
+}
+
+// ParseTree parses src as a damsel document and returns its tree, rooted at a DocumentNode.
+// The tree may be modified before being written with WriteTo. A returned error will be of
+// type *Error.
+func (p *DocParser) ParseTree(src []byte) (*Elem, error) {
+	if _, err := p.parse(src); err != nil {
+		return nil, err
 	}
-	return result, err
+	return p.root, nil
+}
+
+// errorf halts parsing with an error located at pos of the document.
+func (p *DocParser) errorf(pos int, format string, args ...interface{}) {
+	panic(p.lex.errorAt(pos, fmt.Errorf(format, args...)))
 }
 
 func (p *DocParser) ReadPos(pos int) rune {
@@ -182,50 +411,183 @@ func (p *DocParser) ReadPos(pos int) rune {
 	return rune(p.lex.bytes[pos])
 }
 
+// extendCache records el as the element at its indentation level. Levels between el and
+// its parent, and deeper than el, are closed.
 func (p *DocParser) extendCache(el *Elem) {
-	for i := el.ws - len(p.cache) + 1; i > 0; i-- {
+	n := 0
+	if el.parent != p.root {
+		n = el.parent.ws + 1
+	}
+	if n > len(p.cache) {
+		n = len(p.cache)
+	}
+	p.cache = p.cache[:n]
+	for len(p.cache) < el.ws {
 		p.cache = append(p.cache, nil)
 	}
-	p.cache[el.ws] = el
+	p.cache = append(p.cache, el)
+}
+
+// lineIndent returns the indentation of the line holding pos.
+func (p *DocParser) lineIndent(pos int) []byte {
+	b := p.lex.bytes
+	start := bytes.LastIndexByte(b[:pos], '\n') + 1
+	end := start
+	for end < len(b) && (b[end] == ' ' || b[end] == '\t') {
+		end++
+	}
+	return b[start:end]
 }
 
-func (p *DocParser) NewElem() {
-	if p.curWs == 0 {
+// checkIndent errors in StrictIndent mode if the indentation of the line at pos is not
+// consistent with that of el's line, extending it if nested, else matching it.
+func (p *DocParser) checkIndent(pos int, el *Elem, nested bool) {
+	if p.Mode&StrictIndent == 0 || el == nil || el == p.root {
+		return
+	}
+	indent, ref := p.lineIndent(pos), p.lineIndent(el.pos)
+	if nested && bytes.HasPrefix(indent, ref) || !nested && bytes.Equal(indent, ref) {
+		return
+	}
+	p.errorf(pos, "inconsistent use of tabs and spaces in indentation")
+}
+
+func (p *DocParser) NewElem(t Token) {
+	if p.curWs != 0 && p.curWs < p.prevWs && (p.curWs >= len(p.cache) || p.cache[p.curWs] == nil) {
+		p.errorf(t.end, "unindent does not match any outer indentation level")
+	}
+
+	lineStart := t.start == 0 || p.lex.bytes[t.start-1] == '\n'
+	if p.curWs == 0 || p.curElem == nil {
 		p.curElem = p.root.SubElement()
 	} else if p.curWs > p.prevWs {
+		if lineStart {
+			p.checkIndent(t.start, p.cache[p.prevWs], true)
+		}
 		p.curElem = p.cache[p.prevWs].SubElement()
 	} else if p.curWs == p.prevWs {
+		p.checkIndent(t.start, p.cache[p.prevWs], false)
 		p.curElem = p.cache[p.prevWs].parent.SubElement()
 	} else if p.curWs < p.prevWs {
+		p.checkIndent(t.start, p.cache[p.curWs], false)
 		p.curElem = p.cache[p.curWs].parent.SubElement()
-		// TODO is this some old archaic bit not needed anymore?
-		// original issue was assuring that ident line up didn't mis match, so
-		// 0
-		//   1
-		//     2
-		//       3
-		//   4
-		//       5
-		// where 5 wouldn't match anything except 4
-		p.cache = p.cache[:p.curWs+1]
+	}
+
+	if parent := p.curElem.parent; parent.isVoid() {
+		p.errorf(t.start, "void element %s can not have children", parent.tag)
+	} else if parent.typ == DoctypeNode {
+		p.errorf(t.start, "doctype can not have children")
 	}
 
 	p.curElem.ws = p.curWs
+	p.curElem.pos = t.start
 	// TODO can i just setup a findByWhitespace on Elem and call on p.root instead of maintaining a slice
 	p.extendCache(p.curElem)
+
+	if p.leftDelim != nil {
+		p.placeElem(p.curElem, t.start)
+	}
 }
 
 func (p *DocParser) AppendAttrKey(t Token) {
+	if p.curElem == nil {
+		p.errorf(t.start, "attribute %q outside of element", p.lex.bytes[t.start:t.end])
+	}
 	p.curElem.attr = append(p.curElem.attr, [][][]byte{[][]byte{p.lex.bytes[t.start:t.end], nil}}...)
 }
 
 func (p *DocParser) AppendText(t Token) {
+	p.appendText(t, false)
+}
+
+// appendText places the text of t, which is written without escaping if raw.
+func (p *DocParser) appendText(t Token, raw bool) {
+	if p.curElem == nil {
+		p.errorf(t.start, "text outside of element")
+	}
+	if p.textWs < p.curWs && p.textWs != 0 && (p.textWs >= len(p.cache) || p.cache[p.textWs] == nil) {
+		p.errorf(t.start, "text indentation does not match any element")
+	}
+	if p.textWs != 0 {
+		switch {
+		case p.textWs > p.curWs:
+			p.checkIndent(t.start, p.curElem, true)
+		case p.textWs == p.curWs:
+			p.checkIndent(t.start, p.curElem, false)
+		default:
+			p.checkIndent(t.start, p.cache[p.textWs], false)
+		}
+	}
+
+	var m mark
 	if p.textWs == 0 || p.textWs > p.curWs {
-		p.curElem.text = append(p.curElem.text, p.lex.bytes[t.start:t.end])
+		if p.curElem.isVoid() {
+			p.errorf(t.start, "void element %s can not have text", p.curElem.tag)
+		}
+		if el := p.curElem; el.typ == CommentNode && el.parent == p.root && len(el.text) == 0 && len(el.attr) == 0 && isDoctype(p.lex.bytes, t) {
+			el.typ = DoctypeNode
+		}
+		m = mark{el: p.curElem}
 	} else if p.textWs == p.curWs {
-		p.curElem.tail = append(p.curElem.tail, p.lex.bytes[t.start:t.end])
+		m = mark{el: p.curElem, tail: true}
 	} else if p.textWs < p.curWs {
-		p.cache[p.textWs].tail = append(p.cache[p.textWs].tail, p.lex.bytes[t.start:t.end])
+		m = mark{el: p.cache[p.textWs], tail: true}
+	}
+
+	if p.leftDelim != nil {
+		p.placeText(m, t, raw)
+	} else {
+		m.append(chunk{b: p.lex.bytes[t.start:t.end], raw: raw})
+	}
+}
+
+// unescape returns b with each backslash escape replaced by the character it escapes.
+// Template actions are left as is.
+func (p *DocParser) unescape(b []byte) []byte {
+	if bytes.IndexByte(b, '\\') == -1 {
+		return b
+	}
+	segs := []segment{{b: b}}
+	if p.leftDelim != nil {
+		segs = p.splitActions(b)
+	}
+	r := make([]byte, 0, len(b))
+	for _, seg := range segs {
+		if seg.action {
+			r = append(r, seg.b...)
+			continue
+		}
+		for i := 0; i < len(seg.b); i++ {
+			if seg.b[i] == '\\' && i+1 < len(seg.b) {
+				i++
+			}
+			r = append(r, seg.b[i])
+		}
+	}
+	return r
+}
+
+// isDoctype reports whether the text t of a root comment declares a doctype, as in
+// !DOCTYPE html, with doctype following the ! immediately in any case.
+func isDoctype(b []byte, t Token) bool {
+	text := b[t.start:t.end]
+	return t.start > 0 && b[t.start-1] == '!' && len(text) >= 7 && bytes.EqualFold(text[:7], []byte("doctype"))
+}
+
+// isEscaped reports whether text beginning at pos was preceded by a backslash or backtick.
+func isEscaped(b []byte, pos int) bool {
+	return pos > 0 && (b[pos-1] == '\\' || b[pos-1] == '`')
+}
+
+// checkName errors with msg if the selector name of t isn't valid. Names holding template
+// actions are valid once executed, so they're left to be checked then.
+func (p *DocParser) checkName(t Token, valid func([]byte) bool, msg string) {
+	name := p.lex.bytes[t.start:t.end]
+	if p.leftDelim != nil && (bytes.Contains(name, p.leftDelim) || bytes.Contains(name, p.rightDelim)) {
+		return
+	}
+	if !valid(name) {
+		p.errorf(t.start, msg, name)
 	}
 }
 
@@ -239,43 +601,60 @@ func (p *DocParser) ReceiveToken(t Token) {
 			p.prevWs = p.curWs
 			p.curWs++
 		}
-		p.NewElem()
+		p.NewElem(t)
 		break
 	case TokenHashTag:
+		p.checkName(t, isTagName, "invalid tag name %q")
 		p.curElem.tag = p.lex.bytes[t.start:t.end]
+		p.curElem.hasTag = true
 		break
 	case TokenHashId:
+		p.checkName(t, isIdent, "invalid id %q")
 		p.curElem.id = p.lex.bytes[t.start:t.end]
-		p.ids[string(p.curElem.id)] = append(p.ids[string(p.curElem.id)], p.curElem)
 		break
 	case TokenHashClass:
+		p.checkName(t, isIdent, "invalid class name %q")
 		p.curElem.class = append(p.curElem.class, p.lex.bytes[t.start:t.end])
 		break
 	case TokenAttrKey:
 		p.AppendAttrKey(t)
 		break
 	case TokenAttrValue:
-		switch p.lex.bytes[t.start] {
-		case '\'', '"':
-			t.start++
-			t.end--
-			break
+		if n := t.end - t.start; n >= 2 {
+			switch q := p.lex.bytes[t.start]; q {
+			case '\'', '"':
+				if p.lex.bytes[t.end-1] == q {
+					t.start++
+					t.end--
+				}
+				break
+			}
 		}
-		// TODO remove escapes
-		p.curElem.attr[len(p.curElem.attr)-1][1] = p.lex.bytes[t.start:t.end]
+		p.curElem.attr[len(p.curElem.attr)-1][1] = p.unescape(p.lex.bytes[t.start:t.end])
 		break
 	case TokenText:
+		if p.leftDelim != nil && p.textLine && !isEscaped(p.lex.bytes, t.start) {
+			if segs := p.directive(p.lex.bytes[t.start:t.end]); segs != nil {
+				p.placeDirective(segs, t.start)
+				break
+			}
+		}
 		p.AppendText(t)
 		break
+	case TokenTextRaw:
+		p.appendText(t, true)
+		break
 	case TokenTextWs:
 		if t.start != 0 && rune(p.lex.bytes[t.start-1]) != '\n' {
 			p.textWs = 0
+			p.textLine = false
 		} else { // multiline text
 			p.textWs = CountWs(t)
+			p.textLine = true
 		}
 		break
 	case TokenComment:
-		p.curElem.isComment = true
+		p.curElem.typ = CommentNode
 		break
 	case TokenEOF:
 		// TODO
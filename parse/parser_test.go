@@ -0,0 +1,383 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_parse_errors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+	}{
+		{"%html\n  %body[a=1", 2, 11},
+		{"%html\n  %body[a", 2, 9},
+		{"%html\n    %body\n        %p\n  %span", 4, 3},
+		{"%html\n  %p `unterminated", 2, 6},
+		{"[a=1]\n%html", 1, 2},
+		{"", 1, 1},
+		{"!DOCTYPE html\n", 2, 1},
+	}
+	for _, tt := range tests {
+		_, err := NewDocParser("test.dmsl").Parse([]byte(tt.src))
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("%q: expected *Error, got %v", tt.src, err)
+		}
+		if e.Name != "test.dmsl" || e.Line != tt.line || e.Col != tt.col {
+			t.Fatalf("%q: unexpected position %s", tt.src, e)
+		}
+	}
+}
+
+func Test_action_unknown(t *testing.T) {
+	_, err := NewActionParser("test.dmsl").Parse([]byte("%html\n  :nope args\n  %body\n"))
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	var ae *ActionError
+	if !errors.As(err, &ae) || ae.Value != "nope" {
+		t.Fatalf("expected *ActionError, got %v", err)
+	}
+	if e.Line != 2 || e.Col != 3 || e.Snippet != "  :nope args" {
+		t.Fatalf("unexpected position %s %q", e, e.Snippet)
+	}
+}
+
+func Test_action_eof(t *testing.T) {
+	fm := FuncMap{"x": func(a *Action) ([]byte, error) {
+		return []byte(a.Whitespace() + "%p " + string(a.Args)), nil
+	}}
+	tests := []struct {
+		src, expect string
+	}{
+		{":x a\n:x b", "%p a\n%p b"},
+		{"%div\n\t:x a\n\t:x b", "%div\n\t%p a\n\t%p b"},
+		{":x a\n:x", "%p a\n%p "},
+	}
+	for _, tt := range tests {
+		r, err := NewActionParser("test.dmsl").Funcs(fm).Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(r) != tt.expect {
+			t.Fatalf("%q: expected %q, received %q", tt.src, tt.expect, r)
+		}
+	}
+}
+
+func Test_escape(t *testing.T) {
+	tests := []struct {
+		src, expect string
+		mode        Mode
+	}{
+		{"%p a < b & \"c\"", `<p>a &lt; b &amp; "c"</p>`, 0},
+		{"%a[title='say \"hi\" & <bye>'] x", `<a title="say &#34;hi&#34; &amp; &lt;bye&gt;">x</a>`, 0},
+		{"%div[id=a&b][class=c<d]", `<div id="a&amp;b" class="c&lt;d"></div>`, 0},
+		{"%p != <b>bold</b> & more", `<p><b>bold</b> & more</p>`, 0},
+		{"%p\n  a <\n  != <br>\n  \\ > b", `<p>a &lt;<br> &gt; b</p>`, 0},
+		{"%p a < b", `<p>a < b</p>`, NoEscape},
+		{"%script if (a < b && c) { go() }", `<script>if (a < b && c) { go() }</script>`, 0},
+		{"%style\n  a > b { color: red }\n  \\ p & q {}", `<style>a > b { color: red } p & q {}</style>`, 0},
+		{"%script[src=\"a.js?x&y\"]", `<script src="a.js?x&amp;y"></script>`, 0},
+	}
+	for _, tt := range tests {
+		p := NewDocParser("")
+		p.Mode = tt.mode
+		r, err := p.Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, tt.expect, r)
+		}
+	}
+
+	r, err := NewDocParser("").Delims("{", "}").Parse([]byte(`%a[href={.URL}][title="{printf "%q" .Title} & co"] {if eq . "<"}<{end}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `<a href="{.URL}" title="{printf "%q" .Title} &amp; co">{if eq . "<"}&lt;{end}</a>`; r != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, r)
+	}
+}
+
+func Test_void(t *testing.T) {
+	src := "%p\n  %br\n  %img[src=a.png][alt=A]\n  %input[type=text]\n  \\ tail"
+	r, err := NewDocParser("").Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `<p><br><img src="a.png" alt="A"><input type="text"> tail</p>`; r != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, r)
+	}
+
+	p := NewDocParser("")
+	p.Mode = XHTML
+	if r, err = p.Parse([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if expect := `<p><br /><img src="a.png" alt="A" /><input type="text" /> tail</p>`; r != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, r)
+	}
+
+	for _, src := range []string{"%br text", "%img\n  %span", "%p %br %span"} {
+		if _, err := NewDocParser("").Parse([]byte(src)); err == nil {
+			t.Fatalf("%q: expected error", src)
+		}
+	}
+}
+
+func Test_attributes(t *testing.T) {
+	tests := []struct {
+		src, expect string
+		mode        Mode
+	}{
+		{"%input[disabled][type=checkbox][checked]", `<input disabled type="checkbox" checked>`, 0},
+		{"%input[disabled][type=checkbox][checked]", `<input disabled="" type="checkbox" checked="" />`, XHTML},
+		{"%span[a=][b='']", `<span a="" b=""></span>`, 0},
+		{`%a[title=one \] two][alt="say \"hi\""][c=a\\b]`, `<a title="one ] two" alt="say &#34;hi&#34;" c="a\b"></a>`, 0},
+		{`%a[title="unbalanced]`, `<a title="&#34;unbalanced"></a>`, 0},
+	}
+	for _, tt := range tests {
+		p := NewDocParser("")
+		p.Mode = tt.mode
+		r, err := p.Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, tt.expect, r)
+		}
+	}
+}
+
+func Test_render(t *testing.T) {
+	var b strings.Builder
+	if err := NewDocParser("").Render(&b, []byte("%html\n  %body\n    %p a < b")); err != nil {
+		t.Fatal(err)
+	}
+	if expect := `<html><body><p>a &lt; b</p></body></html>`; b.String() != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, b.String())
+	}
+
+	b.Reset()
+	if err := NewDocParser("").Render(&b, []byte("%html\n  %body[a")); err == nil || b.Len() != 0 {
+		t.Fatalf("expected error with nothing written, got %v %q", err, b.String())
+	}
+}
+
+func Test_override(t *testing.T) {
+	base := "%html %body\n  %p before\n  #content.c\n    %span One\n  %p after\n"
+	tests := []struct {
+		src, expect string
+	}{
+		{"#content OVERRIDE", `<p>before</p><div id="content" class="c">OVERRIDE</div><p>after</p>`},
+		{"#content\n  %em Two", `<p>before</p><div id="content" class="c"><em>Two</em></div><p>after</p>`},
+		{"#content[super]\n  %em Two", `<p>before</p><div id="content" class="c"><span>One</span><em>Two</em></div><p>after</p>`},
+		{"#content[append]\n  %em Two", `<p>before</p><div id="content" class="c"><span>One</span><em>Two</em></div><p>after</p>`},
+		{"#content[prepend]\n  %em Two", `<p>before</p><div id="content" class="c"><em>Two</em><span>One</span></div><p>after</p>`},
+		{"#content[before]\n  %em Two", `<p>before</p><em>Two</em><div id="content" class="c"><span>One</span></div><p>after</p>`},
+		{"#content[after]\n  %em Two\n  %em Three", `<p>before</p><div id="content" class="c"><span>One</span></div><em>Two</em><em>Three</em><p>after</p>`},
+		{"%section#content[replace][title=t] Two", `<p>before</p><section id="content" title="t">Two</section><p>after</p>`},
+		{"%section#content[replace][keep=title][title=t] Two", `<p>before</p><section id="content" title="t">Two</section><p>after</p>`},
+		{"#content[after][keep]\n  %em Two", `<p>before</p><div id="content" class="c"><span>One</span></div><em>Two</em><p>after</p>`},
+		{"#content[remove]", `<p>before</p><p>after</p>`},
+		{"#content[after]\n  #more\n#more[prepend] first", `<p>before</p><div id="content" class="c"><span>One</span></div><div id="more">first</div><p>after</p>`},
+		{"#missing\n  #content[remove]", `<p>before</p><p>after</p>`},
+	}
+	for _, tt := range tests {
+		r, err := NewDocParser("").Parse([]byte(base + tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "<html><body>" + tt.expect + "</body></html>"; r != expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, expect, r)
+		}
+	}
+
+	base = "%html %body\n  %main#content.c.d[title=base][lang=en]\n"
+	merges := []struct {
+		src, expect string
+	}{
+		{"#content.wide.c[data-x=1]", `<main id="content" class="c d wide" title="base" lang="en" data-x="1"></main>`},
+		{"%section#content[title=child][super]", `<section id="content" class="c d" title="child" lang="en"></section>`},
+		{"#content[title=child][lang=fr][data-x=1][keep]", `<main id="content" class="c d" title="base" lang="en" data-x="1"></main>`},
+		{"#content[title=child][lang=fr][keep=lang]", `<main id="content" class="c d" title="child" lang="en"></main>`},
+	}
+	for _, tt := range merges {
+		r, err := NewDocParser("").Parse([]byte(base + tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "<html><body>" + tt.expect + "</body></html>"; r != expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, expect, r)
+		}
+	}
+
+	base = "%html %body\n  #content base\n    %span One\n"
+	texts := []struct {
+		src, expect string
+	}{
+		{"#content\n  %em Two", `<div id="content">base<em>Two</em></div>`},
+		{"#content Two", `<div id="content">Two</div>`},
+		{"#content[super] more\n  %em Two", `<div id="content">base<span>One</span>more<em>Two</em></div>`},
+		{"#content[append] more", `<div id="content">base<span>One</span>more</div>`},
+		{"#content[prepend] more\n  %em Two", `<div id="content">more<em>Two</em>base<span>One</span></div>`},
+		{"#content[prepend] more", `<div id="content">morebase<span>One</span></div>`},
+		{"#content[before] more\n  %em Two", `more<em>Two</em><div id="content">base<span>One</span></div>`},
+		{"#content[after] more\n  %em Two", `<div id="content">base<span>One</span></div>more<em>Two</em>`},
+		{"#content[after] more", `<div id="content">base<span>One</span></div>more`},
+	}
+	for _, tt := range texts {
+		r, err := NewDocParser("").Parse([]byte(base + tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "<html><body>" + tt.expect + "</body></html>"; r != expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, expect, r)
+		}
+	}
+
+	for _, src := range []string{"%html %body\n  #content\n#content[before][after]", "%html#top\n#top[remove]"} {
+		if _, err := NewDocParser("").Parse([]byte(src)); err == nil {
+			t.Fatalf("%q: expected error", src)
+		}
+	}
+}
+
+func Test_unicode(t *testing.T) {
+	tests := []struct {
+		src, expect string
+	}{
+		{"%p 日本語のテキスト", `<p>日本語のテキスト</p>`},
+		{"#見出し.大きい.🎉 ✨ done", `<div id="見出し" class="大きい 🎉">✨ done</div>`},
+		{"#_a.-b.--c.x-1_y", `<div id="_a" class="-b --c x-1_y"></div>`},
+		{"%p[dir=rtl][title=שלום] שלום עולם", `<p dir="rtl" title="שלום">שלום עולם</p>`},
+		{"%my-élément.x\n  %ruby 漢\n    %rt かん", `<my-élément class="x"><ruby>漢<rt>かん</rt></ruby></my-élément>`},
+		{"%p\n  %span 😀\n  \\ tail ✔", `<p><span>😀</span> tail ✔</p>`},
+	}
+	for _, tt := range tests {
+		r, err := NewDocParser("").Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, tt.expect, r)
+		}
+	}
+
+	errs := []struct {
+		src       string
+		line, col int
+	}{
+		{"%p\n  #日本[a", 2, 7},
+		{"%p 😀😀\n  %span.😀 `x", 2, 11},
+		{"%日本", 1, 2},
+		{"%1p", 1, 2},
+		{"%p\n  %a×b", 2, 4},
+		{"#1a", 1, 2},
+		{"%p#-2", 1, 4},
+		{"%p\n  .a.b&c", 2, 6},
+		{"#a.c/d", 1, 4},
+		{".", 1, 2},
+	}
+	for _, tt := range errs {
+		_, err := NewDocParser("").Parse([]byte(tt.src))
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("%q: expected *Error, got %v", tt.src, err)
+		}
+		if e.Line != tt.line || e.Col != tt.col {
+			t.Fatalf("%q: unexpected position %s", tt.src, e)
+		}
+	}
+}
+
+func Test_indent(t *testing.T) {
+	// a dedent to a level that was closed by a shallower element
+	src := "%a\n  %b\n    %c\n%d\n    %e\n  %f"
+	if _, err := NewDocParser("").Parse([]byte(src)); err == nil {
+		t.Fatal("expected error for dedent to closed level")
+	}
+
+	valid := []string{
+		"%html\n\t%head\n\t\t%title\n\t%body\n\t\ttext",
+		"%html\n    %body\n      %p\n    %footer",
+		"%html\n\t%body\n\t  %p\n\t  %p\n\t    text",
+		"%html %body\n\t%p\n\t%p",
+	}
+	for _, src := range valid {
+		p := NewDocParser("")
+		p.Mode = StrictIndent
+		if _, err := p.Parse([]byte(src)); err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+	}
+
+	mixed := []struct {
+		src  string
+		line int
+	}{
+		{"%html\n\t%head\n  %body", 3},
+		{"%html\n  %head\n\t\t%title", 3},
+		{"%html\n\t%body\n\t\t%p\n  \t%p", 4},
+		{"%html\n\t%body\n\t\t%p\n    text", 4},
+		{"%html\n\t%body\n\t\t%p\n\t    text", 4},
+		{"%html\n\t%body\n\t\t%p\n\t\t  text", 0},
+	}
+	for _, tt := range mixed {
+		p := NewDocParser("")
+		p.Mode = StrictIndent
+		_, err := p.Parse([]byte(tt.src))
+		if tt.line == 0 {
+			if err != nil {
+				t.Fatalf("%q: %v", tt.src, err)
+			}
+			continue
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Line != tt.line {
+			t.Fatalf("%q: expected error on line %v, got %v", tt.src, tt.line, err)
+		}
+		if _, err := NewDocParser("").Parse([]byte(tt.src)); err != nil {
+			t.Fatalf("%q: unexpected error without StrictIndent: %v", tt.src, err)
+		}
+	}
+}
+
+func Test_document(t *testing.T) {
+	tests := []struct {
+		src, expect string
+		mode        Mode
+	}{
+		{"", "", Fragment},
+		{"\n  \n", "", Fragment},
+		{"%li One\n%li Two", "<li>One</li><li>Two</li>", Fragment},
+		{"#a x\n#a y", `<div id="a">x</div><div id="a">y</div>`, Fragment},
+		{"!doctype html\n%html", "<!doctype html>\n<html></html>", 0},
+		{"!DOCTYPE html\n!DOCTYPE html\n%html\n  #a x\n#a y", "<!DOCTYPE html>\n" + `<html><div id="a">y</div></html>`, 0},
+		{"!DOCTYPE html\n! note\n%html", "<!DOCTYPE html>\n<!--note--><html></html>", 0},
+		{"! DOCTYPE is only a comment here\n%html", "<!--DOCTYPE is only a comment here--><html></html>", 0},
+		{"%p\n  ! doctype\n%p", "<p><!--doctype--></p>", 0},
+	}
+	for _, tt := range tests {
+		p := NewDocParser("")
+		p.Mode = tt.mode
+		r, err := p.Parse([]byte(tt.src))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.src, err)
+		}
+		if r != tt.expect {
+			t.Fatalf("%q\nexpected %s\nreceived %s", tt.src, tt.expect, r)
+		}
+	}
+
+	for _, src := range []string{"", "\n", "!DOCTYPE html", "! comment", "!DOCTYPE html\n  %html"} {
+		if _, err := NewDocParser("").Parse([]byte(src)); err == nil {
+			t.Fatalf("%q: expected error", src)
+		}
+	}
+}
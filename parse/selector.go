@@ -0,0 +1,458 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector is a parsed css selector matching elements of a document. Supported are type
+// selectors, written as p or %p, the universal selector *, #id, .class, attribute selectors
+// with the operators =, ~=, ^=, $= and *=, and :nth-child. Compound selectors are combined
+// with descendant and child (>) combinators, and a comma separates alternatives.
+type Selector struct {
+	src    string
+	groups [][]compound
+}
+
+// compound is a sequence of simple selectors matching a single element, along with the
+// combinator relating it to the preceding compound, or zero if it's the first.
+type compound struct {
+	combinator byte
+	tag        string
+	id         string
+	classes    []string
+	attrs      []attrSelector
+	nth        []nthChild
+}
+
+type attrSelector struct {
+	key, op, value string
+}
+
+// nthChild matches elements at position a*n+b among the elements of their parent.
+type nthChild struct {
+	a, b int
+}
+
+// ParseSelector parses s as a css selector.
+func ParseSelector(s string) (*Selector, error) {
+	sp := &selectorParser{s: s}
+	groups, err := sp.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{src: s, groups: groups}, nil
+}
+
+// MustParseSelector is like ParseSelector but panics if s is not a valid selector.
+func MustParseSelector(s string) *Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// String returns the source of the selector.
+func (sel *Selector) String() string {
+	return sel.src
+}
+
+// Match reports whether el matches the selector.
+func (sel *Selector) Match(el *Elem) bool {
+	for _, g := range sel.groups {
+		if matchCompound(el, g, len(g)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the first element held by el, in document order, that matches the
+// selector, or nil if there is none.
+func (sel *Selector) Find(el *Elem) *Elem {
+	var found *Elem
+	el.walk(func(e *Elem) bool {
+		if sel.Match(e) {
+			found = e
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// FindAll returns all elements held by el, in document order, that match the selector.
+func (sel *Selector) FindAll(el *Elem) []*Elem {
+	var found []*Elem
+	el.walk(func(e *Elem) bool {
+		if sel.Match(e) {
+			found = append(found, e)
+		}
+		return true
+	})
+	return found
+}
+
+// Find returns the first element held by el, in document order, that matches the css
+// selector, or nil if there is none. An error is returned if selector is invalid.
+func (el *Elem) Find(selector string) (*Elem, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Find(el), nil
+}
+
+// FindAll returns all elements held by el, in document order, that match the css
+// selector. An error is returned if selector is invalid.
+func (el *Elem) FindAll(selector string) ([]*Elem, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindAll(el), nil
+}
+
+// walk calls fn for each element held by el in document order, not descending into
+// comments, until fn returns false.
+func (el *Elem) walk(fn func(*Elem) bool) bool {
+	for _, child := range el.children {
+		if child.typ != ElementNode {
+			continue
+		}
+		if !fn(child) || !child.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCompound reports whether el matches g[i] with the compounds preceding it matching
+// its ancestors as given by the combinators.
+func matchCompound(el *Elem, g []compound, i int) bool {
+	if !g[i].match(el) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if g[i].combinator == '>' {
+		return el.parent != nil && matchCompound(el.parent, g, i-1)
+	}
+	for p := el.parent; p != nil; p = p.parent {
+		if matchCompound(p, g, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compound) match(el *Elem) bool {
+	if el.typ != ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != "*" && !strings.EqualFold(c.tag, string(el.tag)) {
+		return false
+	}
+	if c.id != "" && c.id != string(el.id) {
+		return false
+	}
+	for _, class := range c.classes {
+		if !contains(el.class, []byte(class)) {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(el) {
+			return false
+		}
+	}
+	if len(c.nth) != 0 {
+		k := el.index()
+		for _, n := range c.nth {
+			if !n.match(k) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (a attrSelector) match(el *Elem) bool {
+	v, ok := el.Attr(a.key)
+	if !ok {
+		return false
+	}
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return v == a.value
+	case "~=":
+		for _, f := range strings.Fields(v) {
+			if f == a.value {
+				return true
+			}
+		}
+		return false
+	case "^=":
+		return a.value != "" && strings.HasPrefix(v, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(v, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(v, a.value)
+	}
+	return false
+}
+
+func (n nthChild) match(k int) bool {
+	if n.a == 0 {
+		return k == n.b
+	}
+	return (k-n.b)/n.a >= 0 && (k-n.b)%n.a == 0
+}
+
+// index returns the 1-based position of el among the elements of its parent.
+func (el *Elem) index() int {
+	if el.parent == nil {
+		return 1
+	}
+	k := 0
+	for _, c := range el.parent.children {
+		if c.typ == ElementNode {
+			k++
+		}
+		if c == el {
+			break
+		}
+	}
+	return k
+}
+
+// selectorParser parses the source of a Selector.
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (sp *selectorParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("damsel: selector %q: offset %d: %s", sp.s, sp.pos, fmt.Sprintf(format, args...))
+}
+
+func (sp *selectorParser) parse() ([][]compound, error) {
+	var groups [][]compound
+	var cur []compound
+	var combinator byte
+	for {
+		sp.skipSpace()
+		if sp.pos == len(sp.s) {
+			break
+		}
+		switch sp.s[sp.pos] {
+		case ',':
+			if len(cur) == 0 || combinator != 0 {
+				return nil, sp.errorf("unexpected ,")
+			}
+			groups, cur = append(groups, cur), nil
+			sp.pos++
+			continue
+		case '>':
+			if len(cur) == 0 || combinator != 0 {
+				return nil, sp.errorf("unexpected >")
+			}
+			combinator = '>'
+			sp.pos++
+			continue
+		}
+		if len(cur) != 0 && combinator == 0 {
+			combinator = ' '
+		}
+		c, err := sp.compound()
+		if err != nil {
+			return nil, err
+		}
+		c.combinator = combinator
+		cur = append(cur, c)
+		combinator = 0
+	}
+	if len(cur) == 0 || combinator != 0 {
+		return nil, sp.errorf("unexpected end of selector")
+	}
+	return append(groups, cur), nil
+}
+
+func (sp *selectorParser) compound() (compound, error) {
+	var c compound
+	start := sp.pos
+	switch {
+	case sp.peek() == '*':
+		c.tag = "*"
+		sp.pos++
+	case sp.peek() == '%':
+		sp.pos++
+		if c.tag = sp.ident(); c.tag == "" {
+			return c, sp.errorf("expected tag after %%")
+		}
+	default:
+		c.tag = sp.ident()
+	}
+	for sp.pos < len(sp.s) {
+		switch sp.s[sp.pos] {
+		case '#':
+			sp.pos++
+			if c.id = sp.ident(); c.id == "" {
+				return c, sp.errorf("expected id after #")
+			}
+		case '.':
+			sp.pos++
+			class := sp.ident()
+			if class == "" {
+				return c, sp.errorf("expected class after .")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			a, err := sp.attr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+		case ':':
+			n, err := sp.nthChild()
+			if err != nil {
+				return c, err
+			}
+			c.nth = append(c.nth, n)
+		default:
+			if sp.pos == start {
+				return c, sp.errorf("unexpected %q", sp.s[sp.pos])
+			}
+			return c, nil
+		}
+	}
+	return c, nil
+}
+
+func (sp *selectorParser) attr() (attrSelector, error) {
+	var a attrSelector
+	sp.pos++ // [
+	sp.skipSpace()
+	if a.key = sp.ident(); a.key == "" {
+		return a, sp.errorf("expected attribute name")
+	}
+	sp.skipSpace()
+	for _, op := range []string{"=", "~=", "^=", "$=", "*="} {
+		if strings.HasPrefix(sp.s[sp.pos:], op) {
+			a.op = op
+			sp.pos += len(op)
+			break
+		}
+	}
+	if a.op != "" {
+		sp.skipSpace()
+		if q := sp.peek(); q == '"' || q == '\'' {
+			end := strings.IndexByte(sp.s[sp.pos+1:], q)
+			if end == -1 {
+				return a, sp.errorf("unterminated attribute value")
+			}
+			a.value = sp.s[sp.pos+1 : sp.pos+1+end]
+			sp.pos += end + 2
+		} else {
+			start := sp.pos
+			for sp.pos < len(sp.s) && sp.s[sp.pos] != ']' && sp.s[sp.pos] != ' ' {
+				sp.pos++
+			}
+			a.value = sp.s[start:sp.pos]
+		}
+		sp.skipSpace()
+	}
+	if sp.peek() != ']' {
+		return a, sp.errorf("expected ]")
+	}
+	sp.pos++
+	return a, nil
+}
+
+func (sp *selectorParser) nthChild() (nthChild, error) {
+	const prefix = ":nth-child("
+	if !strings.HasPrefix(sp.s[sp.pos:], prefix) {
+		return nthChild{}, sp.errorf("unsupported pseudo-class")
+	}
+	sp.pos += len(prefix)
+	end := strings.IndexByte(sp.s[sp.pos:], ')')
+	if end == -1 {
+		return nthChild{}, sp.errorf("expected )")
+	}
+	n, ok := parseNth(sp.s[sp.pos : sp.pos+end])
+	if !ok {
+		return n, sp.errorf("invalid :nth-child argument")
+	}
+	sp.pos += end + 1
+	return n, nil
+}
+
+// parseNth parses an argument to :nth-child, such as odd, 3 or 2n+1.
+func parseNth(s string) (nthChild, bool) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return nthChild{2, 1}, true
+	case "even":
+		return nthChild{2, 0}, true
+	}
+	i := strings.IndexByte(s, 'n')
+	if i == -1 {
+		b, err := strconv.Atoi(s)
+		return nthChild{0, b}, err == nil
+	}
+	var n nthChild
+	switch a := s[:i]; a {
+	case "", "+":
+		n.a = 1
+	case "-":
+		n.a = -1
+	default:
+		var err error
+		if n.a, err = strconv.Atoi(a); err != nil {
+			return n, false
+		}
+	}
+	if b := s[i+1:]; b != "" {
+		if b[0] != '+' && b[0] != '-' {
+			return n, false
+		}
+		var err error
+		if n.b, err = strconv.Atoi(b); err != nil {
+			return n, false
+		}
+	}
+	return n, true
+}
+
+func (sp *selectorParser) peek() byte {
+	if sp.pos < len(sp.s) {
+		return sp.s[sp.pos]
+	}
+	return 0
+}
+
+func (sp *selectorParser) skipSpace() {
+	for sp.pos < len(sp.s) && strings.IndexByte(" \t\n", sp.s[sp.pos]) != -1 {
+		sp.pos++
+	}
+}
+
+// ident returns the name at the current position, such as a tag, id or class.
+func (sp *selectorParser) ident() string {
+	start := sp.pos
+	for sp.pos < len(sp.s) {
+		c := sp.s[sp.pos]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80 {
+			sp.pos++
+		} else {
+			break
+		}
+	}
+	return sp.s[start:sp.pos]
+}
@@ -0,0 +1,84 @@
+package parse
+
+import "testing"
+
+func Test_find(t *testing.T) {
+	src := `%html
+  %body
+    #nav.menu.top
+      %ul
+        %li[data-k=one] a
+        %li.sel[data-k="two words"] b
+        %li c
+        %li d
+    #main
+      %p first
+      %div %p nested
+      %a[href=https://example.com/x.html][target=_blank] link
+`
+	doc, err := ParseTree([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sel   string
+		count int
+		first string
+	}{
+		{"li", 4, "a"},
+		{"%li", 4, "a"},
+		{"*", 13, "abcdfirstnestedlink"},
+		{"#nav li.sel", 1, "b"},
+		{".menu.top > ul > li", 4, "a"},
+		{"#main > p", 1, "first"},
+		{"#main p", 2, "first"},
+		{"body > li", 0, ""},
+		{"[data-k]", 2, "a"},
+		{"[data-k=one]", 1, "a"},
+		{`li[data-k="two words"]`, 1, "b"},
+		{"[data-k~=words]", 1, "b"},
+		{"a[href^=https][href$='.html'][href*=example]", 1, "link"},
+		{"li:nth-child(2)", 1, "b"},
+		{"li:nth-child(odd)", 2, "a"},
+		{"li:nth-child(2n)", 2, "b"},
+		{"li:nth-child(-n+3)", 3, "a"},
+		{"#main > :nth-child(2) p", 1, "nested"},
+		{"ul li:nth-child(4), #main > p", 2, "d"},
+		{"[class=menu]", 0, ""},
+		{"[class~=menu]", 1, "abcd"},
+	}
+	for _, tt := range tests {
+		all, err := doc.FindAll(tt.sel)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.sel, err)
+		}
+		if len(all) != tt.count {
+			t.Fatalf("%q: expected %v matches, got %v", tt.sel, tt.count, len(all))
+		}
+		first, err := doc.Find(tt.sel)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.sel, err)
+		}
+		if tt.count == 0 {
+			if first != nil {
+				t.Fatalf("%q: expected no match", tt.sel)
+			}
+			continue
+		}
+		if first != all[0] || first.Text() != tt.first {
+			t.Fatalf("%q: unexpected first match %q", tt.sel, first.Text())
+		}
+	}
+
+	for _, sel := range []string{"", "p >", "> p", "p,", "[a", "[=a]", "p:hover", "li:nth-child(x)", "#", "p!"} {
+		if _, err := ParseSelector(sel); err == nil {
+			t.Fatalf("%q: expected error", sel)
+		}
+		if _, err := doc.Find(sel); err == nil {
+			t.Fatalf("%q: expected error from Find", sel)
+		}
+		if _, err := doc.FindAll(sel); err == nil {
+			t.Fatalf("%q: expected error from FindAll", sel)
+		}
+	}
+}
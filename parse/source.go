@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Origin is the file and line a line of a document came from. Actions such as include
+// and extends splice in lines of other files, which retain their origin.
+type Origin struct {
+	Name string `json:"name"`
+	Line int    `json:"line"` // 1-based line number
+
+	indent int // bytes of indentation an action added to the line
+}
+
+func (o Origin) String() string {
+	if o.Name == "" {
+		return strconv.Itoa(o.Line)
+	}
+	return o.Name + ":" + strconv.Itoa(o.Line)
+}
+
+// SourceMap maps the elements of written html back to the source they were parsed from.
+type SourceMap struct {
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping locates the source of an element written at Offset.
+type Mapping struct {
+	Offset int64 `json:"offset"` // byte offset of the element's start tag in the html
+	Origin
+}
+
+// origins returns the origin of each line of b, the source of the named document.
+func origins(name string, b []byte) []Origin {
+	o := make([]Origin, bytes.Count(b, []byte{'\n'})+1)
+	for i := range o {
+		o[i] = Origin{Name: name, Line: i + 1}
+	}
+	return o
+}
+
+// lineTable finds the origin of byte offsets within a document.
+type lineTable struct {
+	name    string
+	starts  []int    // offset of each line
+	origins []Origin // origin of each line, if known
+}
+
+func newLineTable(name string, b []byte, origins []Origin) *lineTable {
+	t := &lineTable{name: name, starts: []int{0}, origins: origins}
+	for i, c := range b {
+		if c == '\n' {
+			t.starts = append(t.starts, i+1)
+		}
+	}
+	return t
+}
+
+// origin returns the origin of the line holding pos.
+func (t *lineTable) origin(pos int) Origin {
+	i := sort.SearchInts(t.starts, pos+1) - 1
+	if i < len(t.origins) {
+		return Origin{Name: t.origins[i].Name, Line: t.origins[i].Line}
+	}
+	return Origin{Name: t.name, Line: i + 1}
+}
+
+// sourceInfo records the origin of elements as they're printed.
+type sourceInfo struct {
+	lines    *lineTable
+	comments bool
+	smap     *SourceMap
+	offset   func() int64 // bytes written so far
+}
+
+// mark records the origin of el, about to be written, with a comment and in the source map.
+func (s *sourceInfo) mark(p *printer, el *Elem) {
+	if el.pos < 0 {
+		return
+	}
+	o := s.lines.origin(el.pos)
+	if s.comments {
+		p.buf.WriteString("<!-- ")
+		p.buf.WriteString(strings.Replace(o.String(), "--", "- -", -1))
+		p.buf.WriteString(" -->")
+	}
+	if s.smap != nil {
+		s.smap.Mappings = append(s.smap.Mappings, Mapping{Offset: s.offset(), Origin: o})
+	}
+}
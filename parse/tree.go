@@ -0,0 +1,161 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+)
+
+// NewElement returns a new element with the given tag, not yet part of any document.
+func NewElement(tag string) *Elem {
+	return &Elem{tag: []byte(tag), hasTag: true, pos: -1}
+}
+
+// Type returns the type of el.
+func (el *Elem) Type() NodeType {
+	return el.typ
+}
+
+// Tag returns the tag name of el, such as "div".
+func (el *Elem) Tag() string {
+	return string(el.tag)
+}
+
+// SetTag sets the tag name of el.
+func (el *Elem) SetTag(tag string) {
+	el.tag, el.hasTag = []byte(tag), true
+}
+
+// ID returns the id of el, or "" if it has none.
+func (el *Elem) ID() string {
+	return string(el.id)
+}
+
+// Classes returns the classes of el in the order they're written.
+func (el *Elem) Classes() []string {
+	var classes []string
+	for _, c := range el.class {
+		classes = append(classes, string(c))
+	}
+	return classes
+}
+
+// Attr returns the value of the attribute key of el and whether it's set. The id and
+// class attributes are included, with classes joined by a space. A boolean attribute,
+// such as [disabled], has an empty value.
+func (el *Elem) Attr(key string) (string, bool) {
+	switch key {
+	case "id":
+		return string(el.id), el.id != nil
+	case "class":
+		return strings.Join(el.Classes(), " "), el.class != nil
+	}
+	for _, v := range el.attr {
+		if string(v[0]) == key {
+			return string(v[1]), true
+		}
+	}
+	return "", false
+}
+
+// SetAttr sets the attribute key of el to value, replacing any existing value. Setting
+// class replaces all classes of el with the space separated fields of value.
+func (el *Elem) SetAttr(key, value string) {
+	switch key {
+	case "id":
+		el.id = []byte(value)
+		return
+	case "class":
+		el.class = bytes.Fields([]byte(value))
+		if el.class == nil {
+			el.class = [][]byte{}
+		}
+		return
+	}
+	for _, v := range el.attr {
+		if string(v[0]) == key {
+			v[1] = []byte(value)
+			return
+		}
+	}
+	el.attr = append(el.attr, [][]byte{[]byte(key), []byte(value)})
+}
+
+// RemoveAttr removes the attribute key from el.
+func (el *Elem) RemoveAttr(key string) {
+	switch key {
+	case "id":
+		el.id = nil
+		return
+	case "class":
+		el.class = nil
+		return
+	}
+	attr := el.attr[:0]
+	for _, v := range el.attr {
+		if string(v[0]) != key {
+			attr = append(attr, v)
+		}
+	}
+	el.attr = attr
+}
+
+// Parent returns the element holding el, or nil if el is the root of its tree.
+func (el *Elem) Parent() *Elem {
+	return el.parent
+}
+
+// Children returns the elements held by el in document order.
+func (el *Elem) Children() []*Elem {
+	return append([]*Elem(nil), el.children...)
+}
+
+// AppendChild adds child as the last element held by el, removing it from its
+// current parent first.
+func (el *Elem) AppendChild(child *Elem) {
+	child.Remove()
+	child.parent = el
+	el.children = append(el.children, child)
+}
+
+// Remove removes el from its parent. The text that follows el is kept in its place, so
+// it's added to the text following the previous element, or to the text of the parent.
+func (el *Elem) Remove() {
+	parent := el.parent
+	if parent == nil {
+		return
+	}
+	i := el.index0()
+	t := parent.textBefore(i)
+	*t = append(*t, el.tail...)
+	parent.children = append(parent.children[:i:i], parent.children[i+1:]...)
+	el.parent, el.tail = nil, nil
+}
+
+// Text returns the text content of el and the elements it holds, without markup. The
+// text of comments and of the doctype is not included.
+func (el *Elem) Text() string {
+	var b strings.Builder
+	el.writeText(&b)
+	return b.String()
+}
+
+func (el *Elem) writeText(b *strings.Builder) {
+	if el.typ == CommentNode || el.typ == DoctypeNode {
+		return
+	}
+	for _, c := range el.text {
+		b.Write(c.b)
+	}
+	for _, child := range el.children {
+		child.writeText(b)
+		for _, c := range child.tail {
+			b.Write(c.b)
+		}
+	}
+}
+
+// SetText replaces the text of el, not including the elements it holds, with text.
+// The text is escaped when written.
+func (el *Elem) SetText(text string) {
+	el.text = []chunk{{b: []byte(text)}}
+}
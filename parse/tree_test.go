@@ -0,0 +1,82 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_tree(t *testing.T) {
+	src := "!DOCTYPE html\n%html\n  %body\n    #main.a.b[data-x=1] hello\n      %span world\n      \\ !\n    %p[hidden] bye\n\n#main\n  %em over\n"
+	doc, err := ParseTree([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Type() != DocumentNode || len(doc.Children()) != 2 || doc.Children()[0].Type() != DoctypeNode {
+		t.Fatal("unexpected document", doc.Children())
+	}
+	html := doc.Children()[1]
+	body := html.Children()[0]
+	if html.Tag() != "html" || body.Parent() != html || html.Parent() != doc {
+		t.Fatal("unexpected tree")
+	}
+	main, p := body.Children()[0], body.Children()[1]
+	if main.ID() != "main" || !reflect.DeepEqual(main.Classes(), []string{"a", "b"}) {
+		t.Fatal("unexpected main", main.ID(), main.Classes())
+	}
+	if v, ok := main.Attr("data-x"); !ok || v != "1" {
+		t.Fatal("unexpected attr", v, ok)
+	}
+	if v, ok := p.Attr("hidden"); !ok || v != "" {
+		t.Fatal("unexpected boolean attr", v, ok)
+	}
+	if _, ok := p.Attr("missing"); ok {
+		t.Fatal("unexpected attr")
+	}
+	// #main was overridden by the root element that followed the document
+	if em := main.Children()[0]; em.Tag() != "em" || em.Parent() != main {
+		t.Fatal("unexpected override", main.Children())
+	}
+	if text := body.Text(); text != "hellooverbye" {
+		t.Fatalf("unexpected text %q", text)
+	}
+
+	main.SetAttr("data-x", "<2>")
+	main.SetAttr("class", "c")
+	p.RemoveAttr("hidden")
+	p.Remove()
+	div := NewElement("div")
+	div.SetText("new")
+	main.AppendChild(div)
+	main.Children()[0].Remove()
+
+	var b strings.Builder
+	if _, err := doc.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!DOCTYPE html>\n" + `<html><body><div id="main" class="c" data-x="&lt;2&gt;">hello<div>new</div></div></body></html>`
+	if b.String() != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, b.String())
+	}
+}
+
+func Test_tree_text(t *testing.T) {
+	doc, err := ParseTree([]byte("!DOCTYPE html\n%html %body\n  %p a\n    ! note\n    \\ b\n    %b c\n    \\ d\n    %i e\n    \\ f\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := doc.Text(); text != "a bc de f" {
+		t.Fatalf("unexpected text %q", text)
+	}
+	p := doc.Children()[1].Children()[0].Children()[0]
+	// the text following a removed element is kept, as by the remove override
+	p.Children()[2].Remove()
+	p.Children()[0].Remove()
+	var b strings.Builder
+	if _, err := p.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "<p>a b<b>c</b> d f</p>"; b.String() != expect {
+		t.Fatalf("expected %s\nreceived %s", expect, b.String())
+	}
+}
@@ -0,0 +1,160 @@
+package damsel
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+
+	"dasa.cc/damsel/parse"
+)
+
+// Set is a collection of templates parsed from the .dmsl files of a file system. Templates
+// in a set include and extend one another by their path within the file system. Each
+// template is compiled once when the set is parsed, or again on execution if the set
+// reloads templates, and the set is safe for concurrent use.
+type Set struct {
+	fsys    fs.FS
+	funcs   parse.FuncMap
+	mode    Mode
+	docMode parse.Mode
+
+	mu     sync.RWMutex
+	reload bool
+	tmpl   map[string]*Template
+	mtimes map[string][]time.Time // of the files of each template when parsed
+}
+
+// NewSet returns an empty set for the templates of fsys.
+func NewSet(fsys fs.FS) *Set {
+	return &Set{fsys: fsys, funcs: make(parse.FuncMap), tmpl: make(map[string]*Template), mtimes: make(map[string][]time.Time)}
+}
+
+// ParseSet returns a set of all the templates in fsys.
+func ParseSet(fsys fs.FS) (*Set, error) {
+	s := NewSet(fsys)
+	err := s.Parse()
+	return s, err
+}
+
+// Funcs adds the elements of the argument map to the actions of each template in the set.
+// It must be called before the set is parsed.
+func (s *Set) Funcs(funcMap parse.FuncMap) *Set {
+	for k, v := range funcMap {
+		s.funcs[k] = v
+	}
+	return s
+}
+
+// Mode sets how templates of the set are combined with html/template. It must be called
+// before the set is parsed.
+func (s *Set) Mode(mode Mode) *Set {
+	s.mode = mode
+	return s
+}
+
+// DocMode sets the options used to parse and write the documents of the set's templates.
+// It must be called before the set is parsed.
+func (s *Set) DocMode(mode parse.Mode) *Set {
+	s.docMode = mode
+	return s
+}
+
+// Reload sets whether ExecuteTemplate first checks the modification times of the named
+// template's file and each file it includes or extends, transitively, and parses the
+// template again if any changed, or parses a template added to the file system since.
+// It's meant for development, so that changes are seen without restarting a program,
+// and is off by default. It may be called while templates are executed.
+func (s *Set) Reload(reload bool) *Set {
+	s.mu.Lock()
+	s.reload = reload
+	s.mu.Unlock()
+	return s
+}
+
+// Parse parses and compiles every file in the set's file system with a .dmsl extension.
+func (s *Set) Parse() error {
+	return fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".dmsl" {
+			return nil
+		}
+		_, err = s.parse(name)
+		return err
+	})
+}
+
+// parse parses and compiles the named template, adding it to the set.
+func (s *Set) parse(name string) (*Template, error) {
+	t := New().Funcs(s.funcs).Loader(FSLoader(s.fsys)).Mode(s.mode).DocMode(s.docMode)
+	if err := t.ParseFile(name); err != nil {
+		return nil, err
+	}
+	if err := t.compileOnce(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.tmpl[name] = t
+	s.mtimes[name] = s.modTimes(t.Files())
+	s.mu.Unlock()
+	return t, nil
+}
+
+// modTimes returns the modification time of each file, or the zero time for a file that
+// can't be read.
+func (s *Set) modTimes(files []string) []time.Time {
+	mtimes := make([]time.Time, len(files))
+	for i, name := range files {
+		if info, err := fs.Stat(s.fsys, name); err == nil {
+			mtimes[i] = info.ModTime()
+		}
+	}
+	return mtimes
+}
+
+// changed reports whether a file the named template was parsed from was modified since,
+// or if the template isn't in the set, whether its file has been added.
+func (s *Set) changed(name string) bool {
+	s.mu.RLock()
+	t, mtimes := s.tmpl[name], s.mtimes[name]
+	s.mu.RUnlock()
+	if t == nil {
+		_, err := fs.Stat(s.fsys, name)
+		return err == nil && path.Ext(name) == ".dmsl"
+	}
+	for i, mtime := range s.modTimes(t.Files()) {
+		if !mtime.Equal(mtimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the template with the given name as last parsed, or nil if there is no
+// such template.
+func (s *Set) Lookup(name string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tmpl[cleanName(name)]
+}
+
+// ExecuteTemplate applies the named template to data and writes the document to w.
+func (s *Set) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	s.mu.RLock()
+	reload := s.reload
+	s.mu.RUnlock()
+	if reload && s.changed(cleanName(name)) {
+		if _, err := s.parse(cleanName(name)); err != nil {
+			return err
+		}
+	}
+	t := s.Lookup(name)
+	if t == nil {
+		return fmt.Errorf("damsel: no template %q in set", name)
+	}
+	return t.execute(w, data)
+}
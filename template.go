@@ -1,13 +1,17 @@
 package damsel
 
 import (
-	"io/ioutil"
-	"path/filepath"
+	"html/template"
+	"io"
+	"strings"
+	"sync"
 
 	"dasa.cc/damsel/parse"
 )
 
 var Debug = false
+
+// TemplateDir is the directory templates are loaded from when no Loader is given.
 var TemplateDir = ""
 
 // SetPprint will force all document output to be pretty printed.
@@ -16,12 +20,79 @@ func SetPprint(b bool) {
 }
 
 type Template struct {
+	name    string
+	funcs   parse.FuncMap
+	loader  Loader
+	mode    Mode
+	docMode parse.Mode
 	result  []byte
+	html    *template.Template
+	stack   []string // files being expanded by include and extends
+	files   []string // files the template was parsed from
+	origins []parse.Origin
+
+	once sync.Once
+	err  error
 }
 
-// New returns a new template with no data.
+// New returns a new template with no data. The template's actions are initialized
+// from parse.DefaultFuncMap, which includes the builtin js, css, raw, include and extends.
+// The include and extends actions of the template read files with its Loader.
 func New() *Template {
-	t := &Template{}
+	t := &Template{funcs: make(parse.FuncMap)}
+	for k, v := range parse.DefaultFuncMap {
+		t.funcs[k] = v
+	}
+	t.funcs["extends"] = t.extends
+	t.funcs["include"] = t.include
+	return t
+}
+
+// Name returns the name of the template, which is the filename given to ParseFile.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Loader sets the source of files for ParseFile and the include and extends actions.
+// If unset, files are read from TemplateDir.
+func (t *Template) Loader(loader Loader) *Template {
+	t.loader = loader
+	return t
+}
+
+// Mode sets how the template is combined with html/template when executed. It must be
+// called before the template is compiled, such as by a Set.
+func (t *Template) Mode(mode Mode) *Template {
+	t.mode = mode
+	return t
+}
+
+// DocMode sets the options used to parse and write the template's document, such as
+// parse.XHTML.
+func (t *Template) DocMode(mode parse.Mode) *Template {
+	t.docMode = mode
+	return t
+}
+
+func (t *Template) docParser() *parse.DocParser {
+	p := parse.NewDocParser(t.name)
+	p.Mode = t.docMode
+	return p
+}
+
+func (t *Template) load(name string) ([]byte, error) {
+	if t.loader == nil {
+		return DirLoader(TemplateDir).Load(name)
+	}
+	return t.loader.Load(name)
+}
+
+// Funcs adds the elements of the argument map to the template's actions, overriding
+// any existing action of the same name. It must be called before the template is parsed.
+func (t *Template) Funcs(funcMap parse.FuncMap) *Template {
+	for k, v := range funcMap {
+		t.funcs[k] = v
+	}
 	return t
 }
 
@@ -34,11 +105,20 @@ func Parse(src []byte) (*Template, error) {
 
 // Parse initializes the template with the []byte content.
 func (t *Template) Parse(src []byte) error {
-	s, err := parse.ActionParse(src)
+	t.stack = t.stack[:0]
+	t.files = nil
+	if t.name != "" {
+		t.stack = append(t.stack, fileName(t.loader, t.name))
+		t.files = append(t.files, fileName(t.loader, t.name))
+	}
+	p := parse.NewActionParser(t.name).Funcs(t.funcs)
+	s, err := p.Parse(src)
 	if err != nil {
 		return err
 	}
 	t.result = s
+	t.origins = p.Origins()
+	t.once = sync.Once{}
 	return nil
 }
 
@@ -63,14 +143,23 @@ func ParseFile(filename string) (*Template, error) {
 
 // ParseFile initializes the template with the content of the given filename.
 func (t *Template) ParseFile(filename string) error {
-	b, err := ioutil.ReadFile(filepath.Join(TemplateDir, filename))
+	b, err := t.load(filename)
 	if err != nil {
+		t.files = []string{fileName(t.loader, filename)}
 		return err
 	}
+	t.name = filename
 	err = t.Parse(b)
 	return err
 }
 
+// Files returns the names of the files the template was last parsed from, its own file
+// followed by each file it includes or extends, transitively. Files are named as given to
+// the template's Loader, and are listed when read even if reading or parsing them failed.
+func (t *Template) Files() []string {
+	return append([]string(nil), t.files...)
+}
+
 // ParseResult returns intermediary result. Integration with other template engines such as html/template should use
 // this as source, passing that result on to parse.DocParse.
 func (t *Template) ParseResult() []byte {
@@ -79,18 +168,44 @@ func (t *Template) ParseResult() []byte {
 
 // Result initiates the final parse phase and returns the document as a string.
 func (t *Template) Result() (string, error) {
-	r, err := parse.DocParse(t.result)
-	if err != nil {
+	var b strings.Builder
+	if err := t.Render(&b); err != nil {
 		return "", err
 	}
-	return r, err
+	return b.String(), nil
 }
 
-func init() {
-	parse.DefaultFuncMap = map[string]parse.ActionFn{
-		"js":      js,
-		"css":     css,
-		"extends": extends,
-		"include": include,
+// Render initiates the final parse phase and writes the document to w without
+// executing html/template.
+func (t *Template) Render(w io.Writer) error {
+	return t.docParser().Origins(t.origins).Render(w, t.result)
+}
+
+// RenderMap is like Render, but also returns a map of the written document's elements to
+// the files and lines they came from.
+func (t *Template) RenderMap(w io.Writer) (*parse.SourceMap, error) {
+	m := new(parse.SourceMap)
+	if err := t.docParser().Origins(t.origins).SourceMap(m).Render(w, t.result); err != nil {
+		return nil, err
 	}
+	return m, nil
+}
+
+// Execute applies the template to data with html/template and writes the document to w.
+// The template is compiled on first call, after which Execute is safe for concurrent use.
+func (t *Template) Execute(w io.Writer, data interface{}) error {
+	if err := t.compileOnce(); err != nil {
+		return err
+	}
+	return t.execute(w, data)
+}
+
+func init() {
+	parse.DefaultFuncMap["js"] = js
+	parse.DefaultFuncMap["css"] = css
+	parse.DefaultFuncMap["raw"] = raw
+	// each call is given a new Template reading files from TemplateDir, which tracks
+	// the files it expands
+	parse.DefaultFuncMap["extends"] = func(a *parse.Action) ([]byte, error) { return New().extends(a) }
+	parse.DefaultFuncMap["include"] = func(a *parse.Action) ([]byte, error) { return New().include(a) }
 }